@@ -1,6 +1,9 @@
 package main
 
 import (
+	"debug/elf"
+	"fmt"
+	"github.com/tunz/binch-go/pkg/core"
 	"github.com/tunz/binch-go/pkg/io"
 	"github.com/tunz/binch-go/pkg/view"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
@@ -8,9 +11,47 @@ import (
 	"os"
 )
 
-var filename = kingpin.Arg("file", "ELF binary to edit.").Required().String()
 var logfile = kingpin.Flag("log", "Log filename.").Default(os.DevNull).String()
 
+var editCmd = kingpin.Command("edit", "Edit a binary interactively.").Default()
+var filename = editCmd.Arg("file", "ELF binary to edit.").Required().String()
+var minStringLen = editCmd.Flag("min-str", "Minimum length of strings in the strings view.").Default("4").Int()
+var projectFile = editCmd.Flag("project", "Project file of labels and comments. (default: <file>.binch)").String()
+var displayBase = editCmd.Flag("base", "Show addresses as loaded at this base, e.g. 0x555555554000.").Uint64()
+var sysroot = editCmd.Flag("sysroot", "Directory to look up the files that a core file maps in.").String()
+
+var printDynamicCmd = kingpin.Command("print-dynamic", "Print the interpreter and the dynamic section.")
+var printDynamicFile = printDynamicCmd.Arg("file", "ELF binary.").Required().String()
+
+var setInterpreterCmd = kingpin.Command("set-interpreter", "Change the program interpreter.")
+var setInterpreterFile = setInterpreterCmd.Arg("file", "ELF binary to edit.").Required().String()
+var setInterpreterPath = setInterpreterCmd.Arg("path", "Path of the interpreter.").Required().String()
+
+var setRPathCmd = kingpin.Command("set-rpath", "Set DT_RPATH. An empty path removes it.")
+var setRPathFile = setRPathCmd.Arg("file", "ELF binary to edit.").Required().String()
+var setRPathPath = setRPathCmd.Arg("path", "Library search path.").Required().String()
+
+var setRunPathCmd = kingpin.Command("set-runpath", "Set DT_RUNPATH. An empty path removes it.")
+var setRunPathFile = setRunPathCmd.Arg("file", "ELF binary to edit.").Required().String()
+var setRunPathPath = setRunPathCmd.Arg("path", "Library search path.").Required().String()
+
+var addNeededCmd = kingpin.Command("add-needed", "Add a needed library.")
+var addNeededFile = addNeededCmd.Arg("file", "ELF binary to edit.").Required().String()
+var addNeededLib = addNeededCmd.Arg("lib", "Library name, e.g. libfoo.so.1.").Required().String()
+
+var removeNeededCmd = kingpin.Command("remove-needed", "Remove a needed library.")
+var removeNeededFile = removeNeededCmd.Arg("file", "ELF binary to edit.").Required().String()
+var removeNeededLib = removeNeededCmd.Arg("lib", "Library name.").Required().String()
+
+var injectCmd = kingpin.Command("inject", "Add a needed library, and optionally a stub that runs at startup.")
+var injectFile = injectCmd.Arg("file", "ELF binary to edit.").Required().String()
+var injectLib = injectCmd.Arg("lib", "Library name or path.").Required().String()
+var injectInit = injectCmd.Flag("init", "Assembly of a function that is added to DT_INIT_ARRAY, e.g. \"xor eax, eax; ret\".").String()
+
+var attachCmd = kingpin.Command("attach", "Edit the memory of a running process. Saving writes the patches to the process.")
+var attachPid = attachCmd.Arg("pid", "Process ID.").Required().Int()
+var attachMinStringLen = attachCmd.Flag("min-str", "Minimum length of strings in the strings view.").Default("4").Int()
+
 func setupLogfile(logfile string) *os.File {
 	fpLog, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -21,13 +62,104 @@ func setupLogfile(logfile string) *os.File {
 	return fpLog
 }
 
+// editFile applies an edit to a binary and saves it.
+func editFile(filename string, edit func(b *bcio.Binary) error) {
+	binary := bcio.ReadElf(filename)
+	kingpin.FatalIfError(edit(binary), "%s", filename)
+	binary.Save()
+}
+
+func printDynamic(filename string) {
+	binary := bcio.ReadElf(filename)
+	if interp, err := binary.Interpreter(); err == nil {
+		fmt.Printf("%-16s %s\n", "INTERP", interp)
+	}
+	entries, err := binary.DynamicEntries()
+	kingpin.FatalIfError(err, "%s", filename)
+	for _, e := range entries {
+		if e.Str != "" {
+			fmt.Printf("%-16s %s\n", e.Tag, e.Str)
+		} else {
+			fmt.Printf("%-16s 0x%x\n", e.Tag, e.Value)
+		}
+	}
+}
+
+// inject adds a library and an init stub, and checks the saved file with
+// debug/elf.
+func inject(filename string, lib string, initAsm string) {
+	binary := bcio.ReadElf(filename)
+	addr, err := binch.MakeProject(binary).InjectLibrary(lib, initAsm)
+	kingpin.FatalIfError(err, "%s", filename)
+	binary.Save()
+	kingpin.FatalIfError(bcio.CheckInjection(filename, lib, addr), "%s", filename)
+	if addr != 0 {
+		fmt.Printf("%s is needed, and the stub at 0x%x runs at startup\n", lib, addr)
+	} else {
+		fmt.Printf("%s is needed\n", lib)
+	}
+}
+
 func main() {
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	var logfp *os.File
 	setupLogfile(*logfile)
 	defer logfp.Close()
 
-	binary := bcio.ReadElf(*filename)
-	bcview.Run(*filename, binary)
+	switch command {
+	case printDynamicCmd.FullCommand():
+		printDynamic(*printDynamicFile)
+		return
+	case setInterpreterCmd.FullCommand():
+		editFile(*setInterpreterFile, func(b *bcio.Binary) error {
+			return b.SetInterpreter(*setInterpreterPath)
+		})
+		return
+	case setRPathCmd.FullCommand():
+		editFile(*setRPathFile, func(b *bcio.Binary) error {
+			return b.SetSearchPath(elf.DT_RPATH, *setRPathPath)
+		})
+		return
+	case setRunPathCmd.FullCommand():
+		editFile(*setRunPathFile, func(b *bcio.Binary) error {
+			return b.SetSearchPath(elf.DT_RUNPATH, *setRunPathPath)
+		})
+		return
+	case addNeededCmd.FullCommand():
+		editFile(*addNeededFile, func(b *bcio.Binary) error {
+			return b.AddNeeded(*addNeededLib)
+		})
+		return
+	case removeNeededCmd.FullCommand():
+		editFile(*removeNeededFile, func(b *bcio.Binary) error {
+			return b.RemoveNeeded(*removeNeededLib)
+		})
+		return
+	case injectCmd.FullCommand():
+		inject(*injectFile, *injectLib, *injectInit)
+		return
+	case attachCmd.FullCommand():
+		binary, err := bcio.ReadProcess(*attachPid)
+		kingpin.FatalIfError(err, "pid %d", *attachPid)
+		// Addresses of a process change between runs, so annotations are not kept.
+		bcview.Run(fmt.Sprintf("pid %d", *attachPid), binary, bcview.Options{MinStringLen: *attachMinStringLen})
+		return
+	}
+
+	if *projectFile == "" {
+		*projectFile = *filename + ".binch"
+	}
+
+	var binary *bcio.Binary
+	if *sysroot != "" {
+		binary = bcio.ReadCore(*filename, *sysroot)
+	} else {
+		binary = bcio.ReadElf(*filename)
+	}
+	bcview.Run(*filename, binary, bcview.Options{
+		MinStringLen: *minStringLen,
+		ProjectFile:  *projectFile,
+		Base:         *displayBase,
+	})
 }
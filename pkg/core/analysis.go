@@ -0,0 +1,326 @@
+package binch
+
+import (
+	"github.com/bnagy/gapstone"
+	"sort"
+)
+
+// flowInfo is the control flow effect of an instruction.
+type flowInfo struct {
+	target    uint64
+	hasTarget bool
+	isCall    bool
+	isJump    bool
+	// isEnd means that the next instruction is never reached from this one,
+	// e.g. ret or an unconditional jump.
+	isEnd bool
+}
+
+func hasGroup(ins *gapstone.Instruction, group uint) bool {
+	for _, g := range ins.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func immTarget(ins *gapstone.Instruction) (uint64, bool) {
+	switch {
+	case ins.X86 != nil && len(ins.X86.Operands) == 1:
+		if op := ins.X86.Operands[0]; op.Type == gapstone.X86_OP_IMM {
+			return uint64(op.Imm), true
+		}
+	case ins.Arm64 != nil && len(ins.Arm64.Operands) != 0:
+		// The target is the last operand, e.g. "cbz x0, #0x400".
+		if op := ins.Arm64.Operands[len(ins.Arm64.Operands)-1]; op.Type == gapstone.ARM64_OP_IMM {
+			return uint64(op.Imm), true
+		}
+	}
+	return 0, false
+}
+
+// immsOf returns the immediate operands of an instruction.
+func immsOf(ins *gapstone.Instruction) []int64 {
+	imms := make([]int64, 0)
+	switch {
+	case ins.X86 != nil:
+		for _, op := range ins.X86.Operands {
+			if op.Type == gapstone.X86_OP_IMM {
+				imms = append(imms, op.Imm)
+			}
+		}
+	case ins.Arm64 != nil:
+		for _, op := range ins.Arm64.Operands {
+			if op.Type == gapstone.ARM64_OP_IMM {
+				imms = append(imms, op.Imm)
+			}
+		}
+	}
+	return imms
+}
+
+// refsOf returns the addresses that an instruction refers to by immediates
+// and memory operands, such as "lea rax, [rip + 0x1234]".
+func refsOf(ins *gapstone.Instruction) []uint64 {
+	refs := make([]uint64, 0)
+	if ins.X86 != nil {
+		for _, op := range ins.X86.Operands {
+			switch {
+			case op.Type == gapstone.X86_OP_IMM && op.Imm > 0:
+				refs = append(refs, uint64(op.Imm))
+			case op.Type == gapstone.X86_OP_MEM && op.Mem.Base == gapstone.X86_REG_RIP:
+				next := uint64(ins.Address) + uint64(len(ins.Bytes))
+				refs = append(refs, next+uint64(op.Mem.Disp))
+			case op.Type == gapstone.X86_OP_MEM && op.Mem.Base == 0 && op.Mem.Index == 0:
+				refs = append(refs, uint64(op.Mem.Disp))
+			}
+		}
+		return refs
+	}
+	for _, imm := range immsOf(ins) {
+		refs = append(refs, uint64(imm))
+	}
+	return refs
+}
+
+func flowOf(ins *gapstone.Instruction) flowInfo {
+	var flow flowInfo
+	switch {
+	case hasGroup(ins, gapstone.CS_GRP_CALL):
+		flow.isCall = true
+	case hasGroup(ins, gapstone.CS_GRP_JUMP):
+		flow.isJump = true
+		switch ins.Mnemonic {
+		case "jmp", "ljmp", "b", "br":
+			flow.isEnd = true
+		}
+	case hasGroup(ins, gapstone.CS_GRP_RET), hasGroup(ins, gapstone.CS_GRP_IRET):
+		flow.isEnd = true
+	default:
+		switch ins.Mnemonic {
+		case "ret", "hlt", "ud2":
+			flow.isEnd = true
+		}
+	}
+	if flow.isCall || flow.isJump {
+		flow.target, flow.hasTarget = immTarget(ins)
+	}
+	return flow
+}
+
+// codeEnd returns the end of the code section that contains addr.
+func (p *Project) codeEnd(addr uint64) uint64 {
+	section := p.storage.CodeRegions()[p.findSectionIdx(addr)]
+	return section.Addr + section.Size
+}
+
+func (p *Project) decodeOne(addr uint64) *gapstone.Instruction {
+	size := p.codeEnd(addr) - addr
+	if size > maxInstrBytes {
+		size = maxInstrBytes
+	}
+	buf := p.storage.ReadMemory(addr, size)
+	if len(buf) == 0 {
+		return nil
+	}
+	insns, err := p.disassembler.Disasm(buf, addr, 1)
+	if err != nil || len(insns) == 0 || isSkipped(&insns[0]) {
+		return nil
+	}
+	return &insns[0]
+}
+
+type codeRange struct {
+	start uint64
+	end   uint64
+}
+
+// recursiveDescent follows the control flow from seeds within [start, end),
+// and returns the decoded instruction ranges and the found function starts.
+// Calls out of the range are function starts, but they are not followed.
+func (p *Project) recursiveDescent(seeds []uint64, start uint64, end uint64) ([]codeRange, map[uint64]bool) {
+	functions := make(map[uint64]bool)
+	visited := make(map[uint64]bool)
+	ranges := make([]codeRange, 0)
+
+	inRange := func(addr uint64) bool { return addr >= start && addr < end }
+	queue := make([]uint64, 0, len(seeds))
+	for _, seed := range seeds {
+		if inRange(seed) {
+			functions[seed] = true
+			queue = append(queue, seed)
+		}
+	}
+
+	for len(queue) != 0 {
+		addr := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		for inRange(addr) && !visited[addr] {
+			visited[addr] = true
+			ins := p.decodeOne(addr)
+			if ins == nil {
+				break
+			}
+			next := addr + uint64(len(ins.Bytes))
+			ranges = append(ranges, codeRange{start: addr, end: next})
+
+			flow := flowOf(ins)
+			if flow.hasTarget && p.IsCode(flow.target) {
+				if flow.isCall {
+					functions[flow.target] = true
+				}
+				if inRange(flow.target) && !visited[flow.target] {
+					queue = append(queue, flow.target)
+				}
+			}
+			if flow.isEnd {
+				break
+			}
+			addr = next
+		}
+	}
+	return ranges, functions
+}
+
+func appendRegion(regions []region, r region) []region {
+	if last := len(regions) - 1; last >= 0 && regions[last].end == r.start && regions[last].typ == r.typ {
+		regions[last].end = r.end
+		return regions
+	}
+	return append(regions, r)
+}
+
+// fillGap sweeps bytes that are not reached by recursive descent. Trailing
+// padding becomes an align region, and bytes that do not decode become db.
+// Skipdata mode is on, so a single sweep covers the whole gap.
+func (p *Project) fillGap(regions []region, start uint64, end uint64) []region {
+	buf := p.storage.ReadMemory(start, end-start)
+	if len(buf) == 0 {
+		return regions
+	}
+
+	bodyEnd := len(buf)
+	for bodyEnd > 0 && isPadding(buf[bodyEnd-1]) && buf[bodyEnd-1] == buf[len(buf)-1] {
+		bodyEnd--
+	}
+
+	for pos := 0; pos < bodyEnd; {
+		addr := start + uint64(pos)
+		insns, err := p.disassembler.Disasm(buf[pos:bodyEnd], addr, 0)
+		if err != nil {
+			break
+		}
+		for _, ins := range insns {
+			size := len(ins.Bytes)
+			if isSkipped(&ins) {
+				regions = appendRegion(regions, region{
+					start: start + uint64(pos),
+					end:   start + uint64(pos+size),
+					typ:   ByteType,
+				})
+			}
+			pos += size
+		}
+	}
+	if bodyEnd < len(buf) {
+		regions = appendRegion(regions, region{start: start + uint64(bodyEnd), end: end, typ: AlignType})
+	}
+	return regions
+}
+
+// maxAnalyzedSize bounds the code sections that are analyzed. Larger ones
+// are disassembled linearly, and only symbols and exception tables tell
+// their functions.
+const maxAnalyzedSize = 64 << 20
+
+// mergeAddrs merges sorted address lists without duplicates.
+func mergeAddrs(a []uint64, b []uint64) []uint64 {
+	set := make(map[uint64]bool, len(a)+len(b))
+	for _, addr := range a {
+		set[addr] = true
+	}
+	for _, addr := range b {
+		set[addr] = true
+	}
+	return sortedAddrs(set)
+}
+
+// addrsIn returns the addresses of a sorted list that are in [start, end).
+func addrsIn(addrs []uint64, start uint64, end uint64) []uint64 {
+	idx := sort.Search(len(addrs), func(i int) bool { return addrs[i] >= start })
+	last := sort.Search(len(addrs), func(i int) bool { return addrs[i] >= end })
+	return addrs[idx:last]
+}
+
+// functionSeeds returns the known function starts that analysis begins
+// from: the entry point, symbols and exception tables.
+func (p *Project) functionSeeds() []uint64 {
+	seeds := map[uint64]bool{p.storage.EntryPoint(): true}
+	for _, symbol := range p.storage.SymbolList() {
+		seeds[symbol.Addr] = true
+	}
+	for _, addr := range p.storage.FunctionHints() {
+		seeds[addr] = true
+	}
+	return sortedAddrs(seeds)
+}
+
+// analyzeRange analyzes the code sections that overlap [start, end) and are
+// not analyzed yet.
+func (p *Project) analyzeRange(start uint64, end uint64) {
+	sections := p.storage.CodeRegions()
+	idx := p.findSectionIdx(start)
+	if idx < 0 {
+		idx = 0
+	}
+	for ; idx < len(sections) && sections[idx].Addr < end; idx++ {
+		if sections[idx].Addr+sections[idx].Size > start {
+			p.analyzeSection(idx)
+		}
+	}
+}
+
+// analyzeSection disassembles a code section by recursive descent from the
+// known function starts in it, and marks bytes that are not code as data
+// regions. Sections are analyzed when they are first needed, so that opening
+// a large program or a process does not analyze all of its code.
+func (p *Project) analyzeSection(sectionIdx int) {
+	section := p.storage.CodeRegions()[sectionIdx]
+	if p.analyzed[section.Addr] {
+		return
+	}
+	p.analyzed[section.Addr] = true
+	end := section.Addr + section.Size
+	// Calls from analyzed sections are function starts as well.
+	seeds := mergeAddrs(addrsIn(p.seeds, section.Addr, end), addrsIn(p.funcStarts, section.Addr, end))
+	if section.Size > maxAnalyzedSize {
+		p.funcStarts = mergeAddrs(p.funcStarts, seeds)
+		return
+	}
+
+	ranges, functions := p.recursiveDescent(seeds, section.Addr, end)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+
+	regions := make([]region, 0)
+	addr := section.Addr
+	for _, r := range ranges {
+		if r.start < addr {
+			// Overlapping instructions. The first one wins.
+			continue
+		}
+		if addr < r.start {
+			regions = p.fillGap(regions, addr, r.start)
+		}
+		addr = r.end
+	}
+	if addr < end {
+		regions = p.fillGap(regions, addr, end)
+	}
+
+	regions = append(regions, p.regions...)
+	sort.Slice(regions, func(i, j int) bool { return regions[i].start < regions[j].start })
+	p.regions = regions
+	p.funcStarts = mergeAddrs(p.funcStarts, sortedAddrs(functions))
+}
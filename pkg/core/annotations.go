@@ -0,0 +1,189 @@
+package binch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// annotationFile is the project file that keeps user labels, comments and
+// bookmarks. Addresses are hex strings so that the file stays readable.
+type annotationFile struct {
+	Labels    map[string]string `json:"labels"`
+	Comments  map[string]string `json:"comments"`
+	Bookmarks map[string]string `json:"bookmarks"`
+}
+
+// Bookmark is a named address.
+type Bookmark struct {
+	Name    string
+	Address uint64
+}
+
+func encodeAnnotations(m map[uint64]string) map[string]string {
+	encoded := make(map[string]string, len(m))
+	for addr, text := range m {
+		encoded[fmt.Sprintf("0x%x", addr)] = text
+	}
+	return encoded
+}
+
+// encodeBookmarks maps names to addresses, which are the values since
+// several bookmarks can share an address.
+func encodeBookmarks(m map[string]uint64) map[string]string {
+	encoded := make(map[string]string, len(m))
+	for name, addr := range m {
+		encoded[name] = fmt.Sprintf("0x%x", addr)
+	}
+	return encoded
+}
+
+func decodeBookmarks(m map[string]string) (map[string]uint64, error) {
+	decoded := make(map[string]uint64, len(m))
+	for name, value := range m {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		decoded[name] = addr
+	}
+	return decoded, nil
+}
+
+func decodeAnnotations(m map[string]string) (map[uint64]string, error) {
+	decoded := make(map[uint64]string, len(m))
+	for key, text := range m {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(key, "0x"), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q", key)
+		}
+		decoded[addr] = text
+	}
+	return decoded, nil
+}
+
+// OpenAnnotations loads user labels and comments from a project file. The
+// file does not need to exist, and later changes are written to it.
+func (p *Project) OpenAnnotations(path string) error {
+	p.annotationPath = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var file annotationFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	labels, err := decodeAnnotations(file.Labels)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	comments, err := decodeAnnotations(file.Comments)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	bookmarks, err := decodeBookmarks(file.Bookmarks)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	p.labels = labels
+	p.comments = comments
+	p.bookmarks = bookmarks
+	p.invalidateAll()
+	return nil
+}
+
+func (p *Project) saveAnnotations() error {
+	if p.annotationPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(annotationFile{
+		Labels:    encodeAnnotations(p.labels),
+		Comments:  encodeAnnotations(p.comments),
+		Bookmarks: encodeBookmarks(p.bookmarks),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.annotationPath, append(data, '\n'), 0644)
+}
+
+// UserLabel returns the name that the user gave to addr, or "".
+func (p *Project) UserLabel(addr uint64) string {
+	return p.labels[addr]
+}
+
+// SetLabel names addr. The name replaces the symbol or the generated name
+// everywhere, and an empty name removes it.
+func (p *Project) SetLabel(addr uint64, name string) error {
+	name = strings.TrimSpace(name)
+	if strings.ContainsAny(name, " \t<>;") {
+		return fmt.Errorf("invalid label: %s", name)
+	}
+	if other, exists := p.LookupName(name); name != "" && exists && other != addr {
+		return fmt.Errorf("%s is already at 0x%x", name, p.ToDisplay(other))
+	}
+	if name == "" {
+		delete(p.labels, addr)
+	} else {
+		p.labels[addr] = name
+	}
+	p.invalidateAll()
+	return p.saveAnnotations()
+}
+
+// UserComment returns the comment of addr, or "".
+func (p *Project) UserComment(addr uint64) string {
+	return p.comments[addr]
+}
+
+// SetComment sets the comment of addr. An empty text removes it.
+func (p *Project) SetComment(addr uint64, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		delete(p.comments, addr)
+	} else {
+		p.comments[addr] = text
+	}
+	p.invalidateAll()
+	return p.saveAnnotations()
+}
+
+// SetBookmark names addr so that it can be found again by the name. A
+// bookmark of the same name is replaced.
+func (p *Project) SetBookmark(name string, addr uint64) error {
+	if name == "" {
+		return fmt.Errorf("empty bookmark name")
+	}
+	p.bookmarks[name] = addr
+	return p.saveAnnotations()
+}
+
+// DeleteBookmark removes a bookmark.
+func (p *Project) DeleteBookmark(name string) error {
+	delete(p.bookmarks, name)
+	return p.saveAnnotations()
+}
+
+// LookupBookmark returns the address of a bookmark.
+func (p *Project) LookupBookmark(name string) (uint64, bool) {
+	addr, exists := p.bookmarks[name]
+	return addr, exists
+}
+
+// Bookmarks returns every bookmark sorted by name.
+func (p *Project) Bookmarks() []Bookmark {
+	bookmarks := make([]Bookmark, 0, len(p.bookmarks))
+	for name, addr := range p.bookmarks {
+		bookmarks = append(bookmarks, Bookmark{Name: name, Address: addr})
+	}
+	sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].Name < bookmarks[j].Name })
+	return bookmarks
+}
@@ -0,0 +1,59 @@
+package binch
+
+import (
+	"fmt"
+	"github.com/tunz/binch-go/pkg/io"
+	"syscall"
+)
+
+// CoreInfo returns the state of the crashed process, or nil if the binary is
+// not a core file.
+func (p *Project) CoreInfo() *bcio.CoreInfo {
+	if p.elf == nil {
+		return nil
+	}
+	return p.elf.Core
+}
+
+// SignalName returns the name of a signal, e.g. "segmentation fault".
+func SignalName(sig int) string {
+	return syscall.Signal(sig).String()
+}
+
+// CrashSummary describes the signal of the faulting thread of a core file, or
+// returns "" if the binary is not a core file.
+func (p *Project) CrashSummary() string {
+	core := p.CoreInfo()
+	if core == nil || len(core.Threads) == 0 {
+		return ""
+	}
+	thread := core.Threads[0]
+	msg := fmt.Sprintf("Thread %d: %s at 0x%x", thread.Pid, SignalName(thread.Signal), thread.PC)
+	if label := p.AddrLabel(thread.PC); label != "" {
+		msg += " " + label
+	}
+	if core.FaultAddr != 0 {
+		msg += fmt.Sprintf(", accessing 0x%x", core.FaultAddr)
+	}
+	return msg
+}
+
+// StartAddress returns where the listing starts and true, or false if there
+// is no code to show, e.g. in a core file whose mapped files are not found.
+// Then the address is where the hex view starts: the faulting address or the
+// first loaded segment.
+func (p *Project) StartAddress() (uint64, bool) {
+	if p.GetInstruction(p.Entry()) != nil {
+		return p.Entry(), true
+	}
+	if regions := p.storage.CodeRegions(); len(regions) != 0 && p.GetInstruction(regions[0].Addr) != nil {
+		return regions[0].Addr, true
+	}
+	if core := p.CoreInfo(); core != nil && core.FaultAddr != 0 && len(p.ReadMemory(core.FaultAddr, 1)) != 0 {
+		return core.FaultAddr, false
+	}
+	if ranges := p.MemoryRanges(); len(ranges) != 0 {
+		return ranges[0].Start, false
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+package binch
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"github.com/tunz/binch-go/pkg/io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// note encodes an ELF note of a core file.
+func note(typ uint32, desc []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{5, uint32(len(desc)), typ})
+	buf.WriteString("CORE\x00\x00\x00\x00")
+	buf.Write(desc)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// writeCore writes an x86-64 core file with one segment at 0x400000, which
+// maps a file that does not exist, and a SIGSEGV at fault.
+func writeCore(t *testing.T, fault uint64) string {
+	const (
+		vaddr    = 0x400000
+		dataOff  = 0x1000
+		dataSize = 0x1000
+	)
+	var files bytes.Buffer
+	binary.Write(&files, binary.LittleEndian, []uint64{1, 0x1000, vaddr, vaddr + dataSize, 0})
+	files.WriteString("/nonexistent/binch-test\x00")
+	siginfo := make([]byte, 128)
+	binary.LittleEndian.PutUint32(siginfo, 11)
+	binary.LittleEndian.PutUint64(siginfo[16:], fault)
+	notes := append(note(0x46494c45, files.Bytes()), note(0x53494749, siginfo)...)
+
+	const phoff = 64
+	noteOff := uint64(phoff + 2*56)
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, elf.Header64{
+		Ident:     [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     phoff,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     2,
+	})
+	binary.Write(&buf, binary.LittleEndian, []elf.Prog64{
+		{Type: uint32(elf.PT_NOTE), Off: noteOff, Filesz: uint64(len(notes))},
+		{Type: uint32(elf.PT_LOAD), Flags: uint32(elf.PF_R | elf.PF_X), Off: dataOff, Vaddr: vaddr,
+			Filesz: dataSize, Memsz: dataSize, Align: 0x1000},
+	})
+	buf.Write(notes)
+	buf.Write(make([]byte, dataOff-buf.Len()))
+	buf.Write(bytes.Repeat([]byte{0xcc}, dataSize))
+
+	filename := filepath.Join(t.TempDir(), "core")
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestCoreWithoutFiles(t *testing.T) {
+	tests := []struct {
+		fault uint64
+		want  uint64
+	}{
+		{0x400010, 0x400010},
+		// An unmapped fault address starts at the first segment.
+		{0x10, 0x400000},
+	}
+	for _, test := range tests {
+		b := bcio.ReadElf(writeCore(t, test.fault))
+		if b.Core == nil || len(b.Core.Files) != 1 || b.Core.Files[0].Loaded {
+			t.Fatalf("Core = %+v, want one file that is not loaded", b.Core)
+		}
+		p := MakeProject(b)
+		if instr := p.GetInstruction(p.Entry()); instr != nil {
+			t.Errorf("GetInstruction(0x%x) = %+v, want nil", p.Entry(), instr)
+		}
+		addr, hasCode := p.StartAddress()
+		if hasCode || addr != test.want {
+			t.Errorf("StartAddress() = 0x%x, %v, want 0x%x, false", addr, hasCode, test.want)
+		}
+		if got := p.ReadMemory(addr, 1); len(got) != 1 || got[0] != 0xcc {
+			t.Errorf("ReadMemory(0x%x) = %v, want the segment", addr, got)
+		}
+	}
+}
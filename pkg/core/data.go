@@ -0,0 +1,252 @@
+package binch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DataType tells how a range of code sections is shown in the listing.
+type DataType int
+
+// Data types of listing lines. CodeType is the default of every byte in code
+// sections.
+const (
+	CodeType DataType = iota
+	ByteType
+	DwordType
+	QwordType
+	StringType
+	AlignType
+)
+
+var dataTypeNames = map[string]DataType{
+	"code":   CodeType,
+	"db":     ByteType,
+	"dd":     DwordType,
+	"dq":     QwordType,
+	"string": StringType,
+	"align":  AlignType,
+}
+
+// ParseDataType returns a data type by its name in the listing, such as "db".
+func ParseDataType(name string) (DataType, bool) {
+	typ, ok := dataTypeNames[strings.ToLower(name)]
+	return typ, ok
+}
+
+type region struct {
+	start uint64
+	end   uint64
+	typ   DataType
+}
+
+const bytesPerDataLine = 8
+
+// regionsIn returns the data regions that overlap [start, end), clipped to
+// the range.
+func (p *Project) regionsIn(start uint64, end uint64) []region {
+	p.analyzeRange(start, end)
+	idx := sort.Search(len(p.regions), func(i int) bool {
+		return p.regions[i].end > start
+	})
+	result := make([]region, 0)
+	for ; idx < len(p.regions) && p.regions[idx].start < end; idx++ {
+		r := p.regions[idx]
+		if r.start < start {
+			r.start = start
+		}
+		if r.end > end {
+			r.end = end
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// RegionType returns the data type of addr.
+func (p *Project) RegionType(addr uint64) DataType {
+	if regions := p.regionsIn(addr, addr+1); len(regions) != 0 {
+		return regions[0].typ
+	}
+	return CodeType
+}
+
+// MarkRegion changes the data type of [addr, addr+size). Marking a range as
+// code removes any data region from it.
+func (p *Project) MarkRegion(addr uint64, size uint64, typ DataType) {
+	if size == 0 {
+		return
+	}
+	end := addr + size
+	p.analyzeRange(addr, end)
+
+	regions := make([]region, 0, len(p.regions)+2)
+	for _, r := range p.regions {
+		if r.end <= addr || r.start >= end {
+			regions = append(regions, r)
+			continue
+		}
+		if r.start < addr {
+			regions = append(regions, region{start: r.start, end: addr, typ: r.typ})
+		}
+		if r.end > end {
+			regions = append(regions, region{start: end, end: r.end, typ: r.typ})
+		}
+	}
+	if typ != CodeType {
+		regions = append(regions, region{start: addr, end: end, typ: typ})
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].start < regions[j].start })
+	p.regions = regions
+
+	for _, section := range p.storage.CodeRegions() {
+		if section.Addr < end && addr < section.Addr+section.Size {
+			p.invalidateSection(section.Addr)
+		}
+	}
+}
+
+func isPadding(b byte) bool {
+	return b == 0x00 || b == 0x90 || b == 0xcc
+}
+
+// DefaultRegionSize guesses how many bytes from addr should become typ when
+// the user does not give a size.
+func (p *Project) DefaultRegionSize(addr uint64, typ DataType) uint64 {
+	idx := p.findSectionIdx(addr)
+	if idx < 0 {
+		return 0
+	}
+	section := p.storage.CodeRegions()[idx]
+	if addr < section.Addr || addr >= section.Addr+section.Size {
+		return 0
+	}
+	buf := p.storage.ReadMemory(addr, section.Addr+section.Size-addr)
+
+	switch typ {
+	case StringType:
+		for i, b := range buf {
+			if b == 0 {
+				return uint64(i + 1)
+			}
+		}
+		return uint64(len(buf))
+	case AlignType:
+		size := 0
+		for size < len(buf) && isPadding(buf[size]) && buf[size] == buf[0] {
+			size++
+		}
+		return uint64(size)
+	case DwordType, QwordType:
+		// A single element. Arrays are marked with an explicit size.
+		size := uint64(4)
+		if typ == QwordType {
+			size = 8
+		}
+		if size > uint64(len(buf)) {
+			return uint64(len(buf))
+		}
+		return size
+	case CodeType:
+		if regions := p.regionsIn(addr, addr+1); len(regions) != 0 {
+			return regions[0].end - addr
+		}
+	}
+	if instr := p.GetInstruction(addr); instr != nil && instr.Address == addr {
+		return uint64(len(instr.Bytes))
+	}
+	return 1
+}
+
+func quoteString(data []byte) string {
+	parts := make([]string, 0)
+	str := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b >= 0x20 && b < 0x7f && b != '"' {
+			str = append(str, b)
+			continue
+		}
+		if len(str) != 0 {
+			parts = append(parts, "\""+string(str)+"\"")
+			str = str[:0]
+		}
+		parts = append(parts, fmt.Sprintf("0x%x", b))
+	}
+	if len(str) != 0 {
+		parts = append(parts, "\""+string(str)+"\"")
+	}
+	return "db " + strings.Join(parts, ", ")
+}
+
+func alignString(start uint64, end uint64, fill byte) string {
+	for align := uint64(2); align <= 0x1000; align <<= 1 {
+		if (start+align-1)&^(align-1) == end {
+			return fmt.Sprintf("align 0x%x", align)
+		}
+	}
+	return fmt.Sprintf("db 0x%x dup(0x%02x)", end-start, fill)
+}
+
+func (p *Project) makeData(addr uint64, data []byte, typ DataType) *Instruction {
+	var str string
+	switch {
+	case typ == StringType:
+		str = quoteString(data)
+	case typ == AlignType:
+		str = alignString(addr, addr+uint64(len(data)), data[0])
+	case typ == DwordType && len(data) == 4:
+		str = fmt.Sprintf("dd 0x%08x", binary.LittleEndian.Uint32(data))
+	case typ == QwordType && len(data) == 8:
+		str = fmt.Sprintf("dq 0x%016x", binary.LittleEndian.Uint64(data))
+	default:
+		hexes := make([]string, len(data))
+		for i, b := range data {
+			hexes[i] = fmt.Sprintf("0x%02x", b)
+		}
+		str = "db " + strings.Join(hexes, ", ")
+		typ = ByteType
+	}
+	return &Instruction{
+		Name:    p.labelOf(addr),
+		Address: addr,
+		Bytes:   data,
+		Str:     str,
+		Type:    typ,
+		Note:    p.comments[addr],
+	}
+}
+
+// dataLines splits a data region into listing lines.
+func (p *Project) dataLines(r region) []*Instruction {
+	buf := copyData(p.storage.ReadMemory(r.start, r.end-r.start))
+	result := make([]*Instruction, 0)
+	for off := 0; off < len(buf); {
+		addr := r.start + uint64(off)
+		size := bytesPerDataLine
+		switch r.typ {
+		case StringType:
+			size = len(buf) - off
+			for i := off; i < len(buf); i++ {
+				if buf[i] == 0 {
+					size = i - off + 1
+					break
+				}
+			}
+		case AlignType:
+			size = 1
+			for off+size < len(buf) && buf[off+size] == buf[off] {
+				size++
+			}
+		case DwordType:
+			size = 4
+		}
+		if off+size > len(buf) {
+			size = len(buf) - off
+		}
+		result = append(result, p.makeData(addr, buf[off:off+size], r.typ))
+		off += size
+	}
+	return result
+}
@@ -0,0 +1,978 @@
+package binch
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Demangle returns the readable form of an Itanium C++ or a Rust (legacy or
+// v0) symbol name. Other names, and names that fail to parse, are returned
+// as they are. A suffix like "@plt" or "@@GLIBC_2.2.5" is kept.
+func Demangle(name string) string {
+	base, suffix := name, ""
+	if idx := strings.IndexByte(name, '@'); idx > 0 {
+		base, suffix = name[:idx], name[idx:]
+	}
+	var result string
+	var ok bool
+	switch {
+	case strings.HasPrefix(base, "_R"):
+		result, ok = demangleRust(base)
+	case strings.HasPrefix(base, "_ZN"):
+		if result, ok = demangleRustLegacy(base); !ok {
+			result, ok = demangleItanium(base)
+		}
+	case strings.HasPrefix(base, "_Z"):
+		result, ok = demangleItanium(base)
+	}
+	if !ok {
+		return name
+	}
+	return result + suffix
+}
+
+// demangleError aborts parsing of a malformed name.
+type demangleError struct{}
+
+// recoverDemangle makes a name that fails to parse stay mangled. Names come
+// from the binary, so a runtime error on a hostile name is treated like a
+// parse error rather than taking down the whole program.
+func recoverDemangle(ok *bool) {
+	if r := recover(); r != nil {
+		*ok = false
+	}
+}
+
+// Kinds of types that need parentheses around a declarator.
+const (
+	plainKind = iota
+	functionKind
+	arrayKind
+)
+
+// cxxType is a type being printed. A declarator such as "*" of a pointer to
+// function goes between left and right, e.g. "void (*" and ")(int)".
+type cxxType struct {
+	left  string
+	right string
+	kind  int
+	ref   string // "&" or "&&" for references, which collapse.
+	// pack holds the types of a template argument pack, or of an expanded
+	// pack, if isPack is set.
+	isPack bool
+	pack   []cxxType
+}
+
+func (t cxxType) String() string {
+	if t.isPack {
+		return joinTypes(t.pack)
+	}
+	return t.left + t.right
+}
+
+func plainType(s string) cxxType {
+	return cxxType{left: s}
+}
+
+// joinTypes prints types of a list, in which packs are expanded.
+func joinTypes(types []cxxType) string {
+	strs := make([]string, 0, len(types))
+	for _, t := range types {
+		str := t.String()
+		if t.isPack && str == "" {
+			continue
+		}
+		strs = append(strs, str)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// mapPack applies f to t, or to every type of t if it is a pack.
+func mapPack(t cxxType, f func(cxxType) cxxType) cxxType {
+	if !t.isPack {
+		return f(t)
+	}
+	pack := make([]cxxType, len(t.pack))
+	for i, elem := range t.pack {
+		pack[i] = mapPack(elem, f)
+	}
+	return cxxType{isPack: true, pack: pack}
+}
+
+// withDeclarator adds a pointer, a reference or a member pointer to t.
+func (t cxxType) withDeclarator(decl string) cxxType {
+	return mapPack(t, func(t cxxType) cxxType {
+		isRef := decl == "&" || decl == "&&"
+		if isRef && t.ref != "" {
+			// T& && is T&, and T&& & is T&.
+			if decl == "&" && t.ref == "&&" {
+				t.left = t.left[:len(t.left)-1]
+				t.ref = "&"
+			}
+			return t
+		}
+		ref := ""
+		if isRef {
+			ref = decl
+		}
+		switch t.kind {
+		case functionKind:
+			return cxxType{left: t.left + "(" + decl, right: ")" + t.right, ref: ref}
+		case arrayKind:
+			return cxxType{left: t.left + "(" + decl, right: ") " + t.right, ref: ref}
+		}
+		if strings.HasSuffix(decl, "::*") {
+			decl = " " + decl
+		}
+		return cxxType{left: t.left + decl, right: t.right, ref: ref}
+	})
+}
+
+// itanium parses a name of the Itanium C++ ABI mangling.
+type itanium struct {
+	s    string
+	pos  int
+	subs []cxxType
+	// tmplArgs are the arguments of the function template being parsed,
+	// which T_ parameters refer to.
+	tmplArgs []cxxType
+	// inType is set while parsing a type, whose template arguments are not
+	// the ones of the encoding.
+	inType int
+	// packIdx is the element of packs to use while a pack expansion is
+	// parsed for each element, or -1. packLen is the length of the pack
+	// that the expansion refers to.
+	packIdx int
+	packLen int
+}
+
+// nameInfo describes a parsed name for the function type that follows.
+type nameInfo struct {
+	template   bool // The last component has template arguments.
+	ctorDtor   bool // Constructors, destructors and conversions have no return type.
+	qualifiers string
+}
+
+func demangleItanium(name string) (result string, ok bool) {
+	defer recoverDemangle(&ok)
+	d := &itanium{s: name, pos: 2, packIdx: -1}
+	result = d.encoding(true)
+	for d.pos < len(d.s) && d.peek() == '.' {
+		result += " [clone " + d.cloneSuffix() + "]"
+	}
+	if d.pos != len(d.s) {
+		return "", false
+	}
+	return result, true
+}
+
+func (d *itanium) fail() {
+	panic(demangleError{})
+}
+
+func (d *itanium) peek() byte {
+	if d.pos >= len(d.s) {
+		return 0
+	}
+	return d.s[d.pos]
+}
+
+func (d *itanium) next() byte {
+	if d.pos >= len(d.s) {
+		d.fail()
+	}
+	c := d.s[d.pos]
+	d.pos++
+	return c
+}
+
+func (d *itanium) consume(prefix string) bool {
+	if strings.HasPrefix(d.s[d.pos:], prefix) {
+		d.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (d *itanium) expect(c byte) {
+	if d.next() != c {
+		d.fail()
+	}
+}
+
+func (d *itanium) cloneSuffix() string {
+	start := d.pos
+	d.pos++
+	for d.pos < len(d.s) && (isAlpha(d.s[d.pos]) || d.s[d.pos] == '_') {
+		d.pos++
+	}
+	for d.pos+1 < len(d.s) && d.s[d.pos] == '.' && isDigit(d.s[d.pos+1]) {
+		d.pos++
+		for d.pos < len(d.s) && isDigit(d.s[d.pos]) {
+			d.pos++
+		}
+	}
+	if d.pos == start+1 {
+		d.fail()
+	}
+	return d.s[start:d.pos]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (d *itanium) number() int {
+	neg := d.consume("n")
+	start := d.pos
+	for d.pos < len(d.s) && isDigit(d.s[d.pos]) {
+		d.pos++
+	}
+	n, err := strconv.Atoi(d.s[start:d.pos])
+	if err != nil {
+		d.fail()
+	}
+	if neg {
+		return -n
+	}
+	return n
+}
+
+// seqID parses the base 36 index of S<seq>_ and T<seq>_, where "_" alone is 0.
+// There are fewer substitutions and template arguments than bytes in the
+// name, so larger indexes fail before they overflow.
+func (d *itanium) seqID() int {
+	if d.consume("_") {
+		return 0
+	}
+	n := 0
+	for {
+		c := d.next()
+		switch {
+		case c == '_':
+			return n + 1
+		case isDigit(c):
+			n = n*36 + int(c-'0')
+		case c >= 'A' && c <= 'Z':
+			n = n*36 + int(c-'A') + 10
+		default:
+			d.fail()
+		}
+		if n > len(d.s) {
+			d.fail()
+		}
+	}
+}
+
+func (d *itanium) atEnd() bool {
+	c := d.peek()
+	return c == 0 || c == 'E' || c == '.'
+}
+
+// encoding parses the name of a function or data. Return types of function
+// templates are shown if withReturn is set.
+func (d *itanium) encoding(withReturn bool) string {
+	switch {
+	case d.peek() == 'T':
+		return d.specialName()
+	case d.consume("GTt"):
+		return "transaction clone for " + d.encoding(true)
+	case d.consume("GV"):
+		return "guard variable for " + d.name(nil)
+	case d.consume("GR"):
+		name := d.name(nil)
+		for !d.consume("_") {
+			d.next()
+		}
+		return "reference temporary for " + name
+	}
+
+	var info nameInfo
+	name := d.name(&info)
+	if d.atEnd() {
+		return name
+	}
+	saved := d.tmplArgs
+	ret := ""
+	if info.template && !info.ctorDtor {
+		ret = d.typ().String() + " "
+		if !withReturn {
+			ret = ""
+		}
+	}
+	params := d.paramList()
+	d.tmplArgs = saved
+	return ret + name + params + info.qualifiers
+}
+
+func (d *itanium) specialName() string {
+	d.expect('T')
+	switch c := d.next(); c {
+	case 'V':
+		return "vtable for " + d.typ().String()
+	case 'T':
+		return "VTT for " + d.typ().String()
+	case 'I':
+		return "typeinfo for " + d.typ().String()
+	case 'S':
+		return "typeinfo name for " + d.typ().String()
+	case 'W':
+		return "TLS wrapper function for " + d.name(nil)
+	case 'H':
+		return "TLS init function for " + d.name(nil)
+	case 'h':
+		d.callOffset('h')
+		return "non-virtual thunk to " + d.encoding(true)
+	case 'v':
+		d.callOffset('v')
+		return "virtual thunk to " + d.encoding(true)
+	case 'c':
+		d.callOffset(d.next())
+		d.callOffset(d.next())
+		return "covariant return thunk to " + d.encoding(true)
+	}
+	d.fail()
+	return ""
+}
+
+func (d *itanium) callOffset(kind byte) {
+	d.number()
+	if kind == 'v' {
+		d.expect('_')
+		d.number()
+	} else if kind != 'h' {
+		d.fail()
+	}
+	d.expect('_')
+}
+
+// paramList parses the parameter types of a function.
+func (d *itanium) paramList() string {
+	params := make([]cxxType, 0)
+	for !d.atEnd() {
+		params = append(params, d.typ())
+	}
+	if len(params) == 0 {
+		d.fail()
+	}
+	if len(params) == 1 && params[0].String() == "void" {
+		return "()"
+	}
+	return "(" + joinTypes(params) + ")"
+}
+
+func (d *itanium) addSub(t cxxType) {
+	d.subs = append(d.subs, t)
+}
+
+var stdSubs = map[byte]string{
+	'a': "std::allocator",
+	'b': "std::basic_string",
+	's': "std::string",
+	'i': "std::istream",
+	'o': "std::ostream",
+	'd': "std::iostream",
+}
+
+// stdPrefixSubs are the expanded abbreviations, which are printed for
+// constructors and destructors of the classes.
+var stdPrefixSubs = map[byte]string{
+	's': "std::basic_string<char, std::char_traits<char>, std::allocator<char> >",
+	'i': "std::basic_istream<char, std::char_traits<char> >",
+	'o': "std::basic_ostream<char, std::char_traits<char> >",
+	'd': "std::basic_iostream<char, std::char_traits<char> >",
+}
+
+// substitution parses S_, S<seq>_ and the abbreviations of std names. The
+// leading 'S' is already consumed. prefix is set in a nested name.
+func (d *itanium) substitution(prefix bool) cxxType {
+	if name, exists := stdPrefixSubs[d.peek()]; exists && prefix && d.pos+1 < len(d.s) {
+		if c := d.s[d.pos+1]; c == 'C' || c == 'D' {
+			d.pos++
+			return plainType(name)
+		}
+	}
+	if name, exists := stdSubs[d.peek()]; exists {
+		d.pos++
+		return plainType(name)
+	}
+	idx := d.seqID()
+	if idx < 0 || idx >= len(d.subs) {
+		d.fail()
+	}
+	return d.subs[idx]
+}
+
+// name parses a name of an entity. info may be nil if the caller does not
+// need it.
+func (d *itanium) name(info *nameInfo) string {
+	if info == nil {
+		info = &nameInfo{}
+	}
+	switch c := d.peek(); {
+	case c == 'N':
+		return d.nestedName(info)
+	case c == 'Z':
+		return d.localName(info)
+	case c == 'S' && d.consume("St"):
+		name := "std::" + d.unqualifiedName("", info)
+		if d.peek() == 'I' {
+			d.addSub(plainType(name))
+			name = d.withTemplateArgs(name)
+			info.template = true
+		}
+		return name
+	case c == 'S':
+		d.pos++
+		name := d.substitution(false).String()
+		if d.peek() == 'I' {
+			name = d.withTemplateArgs(name)
+			info.template = true
+		}
+		return name
+	}
+	name := d.unqualifiedName("", info)
+	if d.peek() == 'I' {
+		d.addSub(plainType(name))
+		name = d.withTemplateArgs(name)
+		info.template = true
+	}
+	return name
+}
+
+func (d *itanium) nestedName(info *nameInfo) string {
+	d.expect('N')
+	info.qualifiers = d.cvQualifiers()
+	if d.consume("R") {
+		info.qualifiers += " &"
+	} else if d.consume("O") {
+		info.qualifiers += " &&"
+	}
+
+	prefix := ""
+	last := ""
+	for !d.consume("E") {
+		info.template = false
+		if d.peek() != 'I' {
+			info.ctorDtor = false
+		}
+		switch c := d.peek(); {
+		case c == 'S' && prefix == "":
+			d.pos++
+			if d.consume("t") {
+				prefix = "std"
+				continue
+			}
+			prefix = d.substitution(true).String()
+			last = lastComponent(prefix)
+			continue
+		case c == 'T':
+			prefix = d.templateParam().String()
+		case c == 'I':
+			if prefix == "" {
+				d.fail()
+			}
+			prefix = d.withTemplateArgs(prefix)
+			info.template = true
+		case c == 'M':
+			d.pos++
+			continue
+		default:
+			name := d.unqualifiedName(last, info)
+			if !info.ctorDtor && !strings.HasPrefix(name, "{") {
+				last = name
+				if idx := strings.Index(name, "[abi:"); idx > 0 {
+					last = name[:idx]
+				}
+			}
+			if prefix != "" {
+				name = prefix + "::" + name
+			}
+			prefix = name
+		}
+		if d.peek() != 'E' {
+			d.addSub(plainType(prefix))
+		}
+	}
+	if prefix == "" {
+		d.fail()
+	}
+	return prefix
+}
+
+// cvQualifiers parses qualifiers, which are mangled in the order restrict,
+// volatile, const, but printed in reverse.
+func (d *itanium) cvQualifiers() string {
+	qualifiers := ""
+	if d.consume("r") {
+		qualifiers = " restrict"
+	}
+	if d.consume("V") {
+		qualifiers = " volatile" + qualifiers
+	}
+	if d.consume("K") {
+		qualifiers = " const" + qualifiers
+	}
+	return qualifiers
+}
+
+// lastComponent returns the last name of a qualified name for constructors,
+// e.g. "vector" of "std::vector<int>".
+func lastComponent(name string) string {
+	depth := 0
+	end := len(name)
+	for i := len(name) - 1; i >= 0; i-- {
+		switch name[i] {
+		case '>':
+			if depth == 0 {
+				end = i
+			}
+			depth++
+		case '<':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		case ':':
+			if depth == 0 {
+				return name[i+1 : end]
+			}
+		}
+	}
+	return name[:end]
+}
+
+func (d *itanium) localName(info *nameInfo) string {
+	d.expect('Z')
+	function := d.encoding(false)
+	d.expect('E')
+	var entity string
+	if d.consume("s") {
+		entity = "string literal"
+	} else {
+		entity = d.name(info)
+	}
+	if d.consume("__") {
+		d.number()
+		d.expect('_')
+	} else if d.consume("_") {
+		d.number()
+	}
+	return function + "::" + entity
+}
+
+// unqualifiedName parses a source name, an operator, a constructor, a
+// destructor or an unnamed type. last is the enclosing class name that
+// constructors and destructors are named after.
+func (d *itanium) unqualifiedName(last string, info *nameInfo) string {
+	var name string
+	switch c := d.peek(); {
+	case isDigit(c):
+		name = d.sourceName()
+	case c == 'L':
+		d.pos++
+		name = d.sourceName()
+	case c == 'C' && d.pos+1 < len(d.s) && d.s[d.pos+1] >= '1' && d.s[d.pos+1] <= '5':
+		d.pos += 2
+		if last == "" {
+			d.fail()
+		}
+		name = last
+		info.ctorDtor = true
+	case c == 'C' && d.consume("CI"):
+		d.next()
+		d.typ()
+		if last == "" {
+			d.fail()
+		}
+		name = last
+		info.ctorDtor = true
+	case c == 'D' && d.pos+1 < len(d.s) && d.s[d.pos+1] >= '0' && d.s[d.pos+1] <= '5':
+		d.pos += 2
+		if last == "" {
+			d.fail()
+		}
+		name = "~" + last
+		info.ctorDtor = true
+	case c == 'U':
+		name = d.unnamedType()
+	case c >= 'a' && c <= 'z':
+		name = d.operatorName(info)
+	default:
+		d.fail()
+	}
+	for d.consume("B") {
+		name += "[abi:" + d.sourceName() + "]"
+	}
+	return name
+}
+
+func (d *itanium) sourceName() string {
+	n := d.number()
+	if n <= 0 || n > len(d.s)-d.pos {
+		d.fail()
+	}
+	name := d.s[d.pos : d.pos+n]
+	d.pos += n
+	if strings.HasPrefix(name, "_GLOBAL__N") {
+		return "(anonymous namespace)"
+	}
+	return name
+}
+
+func (d *itanium) unnamedType() string {
+	switch {
+	case d.consume("Ut"):
+		n := 1
+		if !d.consume("_") {
+			n = d.number() + 2
+			d.expect('_')
+		}
+		return "{unnamed type#" + strconv.Itoa(n) + "}"
+	case d.consume("Ul"):
+		d.inType++
+		params := d.paramList()
+		d.inType--
+		d.expect('E')
+		n := 1
+		if !d.consume("_") {
+			n = d.number() + 2
+			d.expect('_')
+		}
+		return "{lambda" + params + "#" + strconv.Itoa(n) + "}"
+	}
+	d.fail()
+	return ""
+}
+
+var cxxOperators = map[string]string{
+	"nw": "new", "na": "new[]", "dl": "delete", "da": "delete[]",
+	"ps": "+", "ng": "-", "ad": "&", "de": "*", "co": "~",
+	"pl": "+", "mi": "-", "ml": "*", "dv": "/", "rm": "%",
+	"an": "&", "or": "|", "eo": "^", "aS": "=",
+	"pL": "+=", "mI": "-=", "mL": "*=", "dV": "/=", "rM": "%=",
+	"aN": "&=", "oR": "|=", "eO": "^=",
+	"ls": "<<", "rs": ">>", "lS": "<<=", "rS": ">>=",
+	"eq": "==", "ne": "!=", "lt": "<", "gt": ">", "le": "<=", "ge": ">=",
+	"ss": "<=>", "nt": "!", "aa": "&&", "oo": "||",
+	"pp": "++", "mm": "--", "cm": ",", "pm": "->*", "pt": "->",
+	"cl": "()", "ix": "[]", "qu": "?", "aw": "co_await",
+}
+
+func (d *itanium) operatorName(info *nameInfo) string {
+	if d.pos+2 > len(d.s) {
+		d.fail()
+	}
+	code := d.s[d.pos : d.pos+2]
+	d.pos += 2
+	switch {
+	case code == "cv":
+		info.ctorDtor = true
+		return "operator " + d.typ().String()
+	case code == "li":
+		return "operator\"\" " + d.sourceName()
+	case code[0] == 'v' && isDigit(code[1]):
+		return "operator " + d.sourceName()
+	}
+	op, exists := cxxOperators[code]
+	if !exists {
+		d.fail()
+	}
+	if isAlpha(op[0]) {
+		return "operator " + op
+	}
+	return "operator" + op
+}
+
+// withTemplateArgs parses template arguments and appends them to name.
+func (d *itanium) withTemplateArgs(name string) string {
+	d.expect('I')
+	d.inType++
+	args := make([]cxxType, 0)
+	for !d.consume("E") {
+		args = append(args, d.templateArg())
+	}
+	d.inType--
+	if d.inType == 0 {
+		d.tmplArgs = args
+	}
+	if strings.HasSuffix(name, "<") {
+		// e.g. "operator<< <char>"
+		name += " "
+	}
+	result := name + "<" + joinTypes(args)
+	if strings.HasSuffix(result, ">") {
+		result += " "
+	}
+	return result + ">"
+}
+
+func (d *itanium) templateArg() cxxType {
+	switch d.peek() {
+	case 'L':
+		return plainType(d.literal())
+	case 'J':
+		d.pos++
+		pack := make([]cxxType, 0)
+		for !d.consume("E") {
+			pack = append(pack, d.templateArg())
+		}
+		return cxxType{isPack: true, pack: pack}
+	case 'X':
+		// Only expressions of a template parameter or a literal are
+		// supported.
+		d.pos++
+		var t cxxType
+		switch d.peek() {
+		case 'T':
+			t = d.templateParam()
+		case 'L':
+			t = plainType(d.literal())
+		default:
+			d.fail()
+		}
+		d.expect('E')
+		return t
+	}
+	return d.typ()
+}
+
+func (d *itanium) literal() string {
+	d.expect('L')
+	if d.consume("_Z") {
+		name := d.encoding(true)
+		d.expect('E')
+		return name
+	}
+	t := d.typ().String()
+	start := d.pos
+	for d.peek() != 'E' {
+		d.next()
+	}
+	value := d.s[start:d.pos]
+	d.pos++
+	if strings.HasPrefix(value, "n") {
+		value = "-" + value[1:]
+	}
+	switch t {
+	case "bool":
+		if value == "0" {
+			return "false"
+		}
+		return "true"
+	case "int":
+		return value
+	case "unsigned int":
+		return value + "u"
+	case "long":
+		return value + "l"
+	case "unsigned long":
+		return value + "ul"
+	}
+	return "(" + t + ")" + value
+}
+
+func (d *itanium) templateParam() cxxType {
+	d.expect('T')
+	idx := d.seqID()
+	if idx < 0 || idx >= len(d.tmplArgs) {
+		d.fail()
+	}
+	arg := d.tmplArgs[idx]
+	if arg.isPack {
+		d.packLen = len(arg.pack)
+		if d.packIdx >= 0 && d.packIdx < len(arg.pack) {
+			return arg.pack[d.packIdx]
+		}
+	}
+	return arg
+}
+
+// packExpansion parses the pattern of a pack expansion once for each type of
+// the pack that it refers to.
+func (d *itanium) packExpansion() cxxType {
+	savedIdx, savedLen := d.packIdx, d.packLen
+	defer func() { d.packIdx, d.packLen = savedIdx, savedLen }()
+
+	start := d.pos
+	numSubs := len(d.subs)
+	d.packIdx, d.packLen = -1, -1
+	pattern := d.typ()
+	if d.packLen < 0 {
+		return cxxType{left: pattern.left, right: pattern.right + "...", kind: pattern.kind}
+	}
+
+	// Substitutions are numbered as if the pattern is parsed once.
+	subs := d.subs
+	end := d.pos
+	pack := make([]cxxType, d.packLen)
+	for i := range pack {
+		d.subs = append([]cxxType{}, subs[:numSubs]...)
+		d.pos = start
+		d.packIdx = i
+		pack[i] = d.typ()
+	}
+	d.subs = subs
+	d.pos = end
+	return cxxType{isPack: true, pack: pack}
+}
+
+var cxxBuiltins = map[byte]string{
+	'v': "void", 'w': "wchar_t", 'b': "bool",
+	'c': "char", 'a': "signed char", 'h': "unsigned char",
+	's': "short", 't': "unsigned short", 'i': "int", 'j': "unsigned int",
+	'l': "long", 'm': "unsigned long", 'x': "long long", 'y': "unsigned long long",
+	'n': "__int128", 'o': "unsigned __int128",
+	'f': "float", 'd': "double", 'e': "long double", 'g': "__float128",
+	'z': "...",
+}
+
+var cxxExtBuiltins = map[byte]string{
+	'd': "decimal64", 'e': "decimal128", 'f': "decimal32", 'h': "half",
+	'i': "char32_t", 's': "char16_t", 'u': "char8_t",
+	'a': "auto", 'c': "decltype(auto)", 'n': "decltype(nullptr)",
+}
+
+func (d *itanium) typ() cxxType {
+	d.inType++
+	defer func() { d.inType-- }()
+
+	c := d.peek()
+	if name, exists := cxxBuiltins[c]; exists {
+		d.pos++
+		return plainType(name)
+	}
+
+	var t cxxType
+	switch c {
+	case 'r', 'V', 'K':
+		qualifiers := d.cvQualifiers()
+		var inner cxxType
+		if d.peek() == 'F' {
+			// The function type of a qualified member function is not a
+			// substitution candidate.
+			inner = d.functionType()
+		} else {
+			inner = d.typ()
+		}
+		t = mapPack(inner, func(inner cxxType) cxxType {
+			if inner.kind == functionKind {
+				// Qualifiers of a member function type.
+				return cxxType{left: inner.left, right: inner.right + qualifiers, kind: functionKind}
+			}
+			if inner.kind == arrayKind {
+				return cxxType{left: strings.TrimSuffix(inner.left, " ") + qualifiers + " ", right: inner.right, kind: arrayKind}
+			}
+			if strings.HasSuffix(inner.left, qualifiers) {
+				// A template parameter may be qualified already.
+				return inner
+			}
+			return cxxType{left: inner.left + qualifiers, right: inner.right, kind: inner.kind}
+		})
+	case 'P':
+		d.pos++
+		t = d.typ().withDeclarator("*")
+	case 'R':
+		d.pos++
+		t = d.typ().withDeclarator("&")
+	case 'O':
+		d.pos++
+		t = d.typ().withDeclarator("&&")
+	case 'F':
+		t = d.functionType()
+	case 'A':
+		d.pos++
+		size := ""
+		if isDigit(d.peek()) {
+			size = strconv.Itoa(d.number())
+		}
+		d.expect('_')
+		inner := d.typ()
+		t = cxxType{left: inner.left + " ", right: "[" + size + "]" + inner.right, kind: arrayKind}
+		if inner.kind == arrayKind {
+			t.left = inner.left
+		}
+	case 'M':
+		d.pos++
+		class := d.typ().String()
+		t = d.typ().withDeclarator(class + "::*")
+	case 'T':
+		t = d.templateParam()
+		d.addSub(t)
+		if d.peek() != 'I' {
+			return t
+		}
+		t = plainType(d.withTemplateArgs(t.String()))
+	case 'S':
+		if strings.HasPrefix(d.s[d.pos:], "St") {
+			t = plainType(d.name(nil))
+			break
+		}
+		d.pos++
+		t = d.substitution(false)
+		if d.peek() != 'I' {
+			return t
+		}
+		t = plainType(d.withTemplateArgs(t.String()))
+	case 'D':
+		d.pos++
+		e := d.next()
+		if name, exists := cxxExtBuiltins[e]; exists {
+			return plainType(name)
+		}
+		switch e {
+		case 'p':
+			t = d.packExpansion()
+		case 'o':
+			if d.peek() != 'F' {
+				d.fail()
+			}
+			t = d.functionType()
+			t.right += " noexcept"
+		case 'F':
+			t = plainType("_Float" + strconv.Itoa(d.number()))
+			d.expect('_')
+			return t
+		default:
+			d.fail()
+		}
+	case 'u':
+		d.pos++
+		t = plainType(d.sourceName())
+	case 'N', 'Z':
+		t = plainType(d.name(nil))
+	default:
+		if !isDigit(c) && c != 'U' {
+			d.fail()
+		}
+		t = plainType(d.name(nil))
+	}
+	d.addSub(t)
+	return t
+}
+
+// functionType parses F [Y] <return type> <parameter types> [R|O] E.
+func (d *itanium) functionType() cxxType {
+	d.pos++
+	d.consume("Y")
+	ret := d.typ().String()
+	params := make([]cxxType, 0)
+	for d.peek() != 'E' && !strings.HasPrefix(d.s[d.pos:], "RE") && !strings.HasPrefix(d.s[d.pos:], "OE") {
+		params = append(params, d.typ())
+	}
+	ref := ""
+	if d.consume("R") {
+		ref = " &"
+	} else if d.consume("O") {
+		ref = " &&"
+	}
+	d.expect('E')
+	if len(params) == 1 && params[0].String() == "void" {
+		params = nil
+	}
+	return cxxType{left: ret + " ", right: "(" + joinTypes(params) + ")" + ref, kind: functionKind}
+}
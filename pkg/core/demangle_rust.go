@@ -0,0 +1,600 @@
+package binch
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var rustLegacyEscapes = map[string]string{
+	"SP": "@", "BP": "*", "RF": "&", "LT": "<", "GT": ">",
+	"LP": "(", "RP": ")", "C": ",",
+}
+
+func isHash(s string) bool {
+	if len(s) != 17 || s[0] != 'h' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// demangleRustLegacy demangles a Rust symbol of the legacy scheme, which is
+// an Itanium nested name whose last component is a hash such as
+// "17h0123456789abcdefE". The hash is dropped.
+func demangleRustLegacy(name string) (string, bool) {
+	s := strings.TrimPrefix(name, "_ZN")
+	parts := make([]string, 0)
+	for !strings.HasPrefix(s, "E") {
+		end := 0
+		for end < len(s) && isDigit(s[end]) {
+			end++
+		}
+		n, err := strconv.Atoi(s[:end])
+		if err != nil || n <= 0 || n > len(s)-end {
+			return "", false
+		}
+		parts = append(parts, s[end:end+n])
+		s = s[end+n:]
+	}
+	// Clone suffixes such as ".llvm.123" follow the name.
+	if s != "E" && !strings.HasPrefix(s, "E.") {
+		return "", false
+	}
+	if len(parts) < 2 || !isHash(parts[len(parts)-1]) {
+		return "", false
+	}
+
+	parts = parts[:len(parts)-1]
+	for i, part := range parts {
+		decoded, ok := unescapeRustLegacy(part)
+		if !ok {
+			return "", false
+		}
+		parts[i] = decoded
+	}
+	return strings.Join(parts, "::"), true
+}
+
+func unescapeRustLegacy(s string) (string, bool) {
+	if strings.HasPrefix(s, "_$") {
+		s = s[1:]
+	}
+	var b strings.Builder
+	for len(s) > 0 {
+		switch {
+		case s[0] == '$':
+			end := strings.IndexByte(s[1:], '$')
+			if end < 0 {
+				return "", false
+			}
+			escape := s[1 : end+1]
+			s = s[end+2:]
+			if decoded, exists := rustLegacyEscapes[escape]; exists {
+				b.WriteString(decoded)
+				continue
+			}
+			if !strings.HasPrefix(escape, "u") {
+				return "", false
+			}
+			c, err := strconv.ParseUint(escape[1:], 16, 32)
+			if err != nil {
+				return "", false
+			}
+			b.WriteRune(rune(c))
+		case strings.HasPrefix(s, ".."):
+			b.WriteString("::")
+			s = s[2:]
+		default:
+			b.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+	return b.String(), true
+}
+
+// rustV0 parses a symbol of the Rust v0 mangling scheme.
+type rustV0 struct {
+	s     string
+	pos   int
+	bound int // lifetimes bound by enclosing for<...> binders
+	depth int // nested backrefs
+}
+
+// Nested backrefs are limited like rustc-demangle does, since each level
+// parses its target again. Backrefs that are used twice in a level double the
+// output, so the length of an expansion is limited as well.
+const (
+	maxRustBackrefDepth = 500
+	maxRustBackrefLen   = 1 << 16
+)
+
+var rustBasicTypes = map[byte]string{
+	'a': "i8", 'b': "bool", 'c': "char", 'd': "f64", 'e': "str", 'f': "f32",
+	'h': "u8", 'i': "isize", 'j': "usize", 'l': "i32", 'm': "u32",
+	'n': "i128", 'o': "u128", 's': "i16", 't': "u16", 'u': "()",
+	'v': "...", 'x': "i64", 'y': "u64", 'z': "!", 'p': "_",
+}
+
+// demangleRust demangles a Rust symbol of the v0 scheme. Crate
+// disambiguators are not shown.
+func demangleRust(name string) (result string, ok bool) {
+	defer recoverDemangle(&ok)
+	d := &rustV0{s: name[2:]}
+	if isDigit(d.peek()) {
+		// Encoding versions other than the initial one are unknown.
+		d.fail()
+	}
+	result = d.path(true)
+	// An instantiating crate may follow, and a vendor suffix after a dot.
+	if d.pos < len(d.s) && d.peek() != '.' {
+		d.path(false)
+	}
+	if d.pos < len(d.s) && d.peek() != '.' {
+		return "", false
+	}
+	return result, true
+}
+
+func (d *rustV0) fail() {
+	panic(demangleError{})
+}
+
+func (d *rustV0) peek() byte {
+	if d.pos >= len(d.s) {
+		return 0
+	}
+	return d.s[d.pos]
+}
+
+func (d *rustV0) next() byte {
+	if d.pos >= len(d.s) {
+		d.fail()
+	}
+	c := d.s[d.pos]
+	d.pos++
+	return c
+}
+
+func (d *rustV0) consume(c byte) bool {
+	if d.peek() == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// base62 parses a number terminated by '_', where "_" alone is 0.
+func (d *rustV0) base62() uint64 {
+	if d.consume('_') {
+		return 0
+	}
+	var n uint64
+	for {
+		c := d.next()
+		var digit uint64
+		switch {
+		case c == '_':
+			return n + 1
+		case isDigit(c):
+			digit = uint64(c - '0')
+		case c >= 'a' && c <= 'z':
+			digit = uint64(c-'a') + 10
+		case c >= 'A' && c <= 'Z':
+			digit = uint64(c-'A') + 36
+		default:
+			d.fail()
+		}
+		n = n*62 + digit
+	}
+}
+
+func (d *rustV0) optBase62(tag byte) uint64 {
+	if !d.consume(tag) {
+		return 0
+	}
+	return d.base62() + 1
+}
+
+func (d *rustV0) decimal() int {
+	// A length of zero has no further digits: "012" is an empty identifier
+	// followed by a 12 byte one.
+	if d.consume('0') {
+		return 0
+	}
+	start := d.pos
+	for isDigit(d.peek()) {
+		d.pos++
+	}
+	n, err := strconv.Atoi(d.s[start:d.pos])
+	if err != nil {
+		d.fail()
+	}
+	return n
+}
+
+// backref runs parse at the position that a backref points to. The 'B' is
+// already consumed, and the target must be before it.
+func (d *rustV0) backref(parse func() string) string {
+	start := d.pos - 1
+	target := d.base62()
+	if target >= uint64(start) || d.depth >= maxRustBackrefDepth {
+		d.fail()
+	}
+	saved := d.pos
+	d.pos = int(target)
+	d.depth++
+	result := parse()
+	d.depth--
+	d.pos = saved
+	if len(result) > maxRustBackrefLen {
+		d.fail()
+	}
+	return result
+}
+
+func (d *rustV0) identifier() (uint64, string) {
+	disambiguator := d.optBase62('s')
+	punycode := d.consume('u')
+	n := d.decimal()
+	d.consume('_')
+	if n > len(d.s)-d.pos {
+		d.fail()
+	}
+	ident := d.s[d.pos : d.pos+n]
+	d.pos += n
+	if punycode {
+		decoded, ok := decodePunycode(ident)
+		if !ok {
+			return disambiguator, "punycode{" + ident + "}"
+		}
+		ident = decoded
+	}
+	return disambiguator, ident
+}
+
+// path parses a path. Generic arguments of paths in values are written with
+// "::<", and in types with "<".
+func (d *rustV0) path(inValue bool) string {
+	switch c := d.next(); c {
+	case 'C':
+		_, ident := d.identifier()
+		return ident
+	case 'M':
+		d.implPath()
+		return "<" + d.typ() + ">"
+	case 'X':
+		d.implPath()
+		self := d.typ()
+		return "<" + self + " as " + d.path(false) + ">"
+	case 'Y':
+		self := d.typ()
+		return "<" + self + " as " + d.path(false) + ">"
+	case 'N':
+		ns := d.next()
+		prefix := d.path(inValue)
+		disambiguator, ident := d.identifier()
+		switch {
+		case ns >= 'a' && ns <= 'z':
+			if ident == "" {
+				return prefix
+			}
+			return prefix + "::" + ident
+		case ns >= 'A' && ns <= 'Z':
+			kind := "shim"
+			if ns == 'C' {
+				kind = "closure"
+			}
+			if ident != "" {
+				kind += ":" + ident
+			}
+			return prefix + "::{" + kind + "#" + strconv.FormatUint(disambiguator, 10) + "}"
+		}
+		d.fail()
+	case 'I':
+		prefix := d.path(inValue)
+		args := make([]string, 0)
+		for !d.consume('E') {
+			args = append(args, d.genericArg())
+		}
+		if inValue {
+			prefix += "::"
+		}
+		return prefix + "<" + strings.Join(args, ", ") + ">"
+	case 'B':
+		return d.backref(func() string { return d.path(inValue) })
+	}
+	d.fail()
+	return ""
+}
+
+func (d *rustV0) implPath() {
+	d.optBase62('s')
+	d.path(false)
+}
+
+func (d *rustV0) genericArg() string {
+	switch {
+	case d.consume('L'):
+		return d.lifetime()
+	case d.consume('K'):
+		return d.constant()
+	}
+	return d.typ()
+}
+
+func (d *rustV0) lifetime() string {
+	i := d.base62()
+	if i == 0 {
+		return "'_"
+	}
+	if i > uint64(d.bound) {
+		d.fail()
+	}
+	return lifetimeName(d.bound - int(i))
+}
+
+func lifetimeName(depth int) string {
+	if depth < 26 {
+		return "'" + string(rune('a'+depth))
+	}
+	return "'_" + strconv.Itoa(depth)
+}
+
+// binder parses a for<...> binder and returns it with a trailing space, or ""
+// if there is none. The caller restores d.bound once the bound scope ends.
+func (d *rustV0) binder() string {
+	n := int(d.optBase62('G'))
+	if n == 0 {
+		return ""
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = lifetimeName(d.bound + i)
+	}
+	d.bound += n
+	return "for<" + strings.Join(names, ", ") + "> "
+}
+
+func (d *rustV0) typ() string {
+	c := d.peek()
+	if name, exists := rustBasicTypes[c]; exists {
+		d.pos++
+		return name
+	}
+	switch c {
+	case 'A':
+		d.pos++
+		elem := d.typ()
+		return "[" + elem + "; " + d.constant() + "]"
+	case 'S':
+		d.pos++
+		return "[" + d.typ() + "]"
+	case 'T':
+		d.pos++
+		elems := make([]string, 0)
+		for !d.consume('E') {
+			elems = append(elems, d.typ())
+		}
+		if len(elems) == 1 {
+			return "(" + elems[0] + ",)"
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	case 'R', 'Q':
+		d.pos++
+		ref := "&"
+		if d.consume('L') {
+			if lifetime := d.lifetime(); lifetime != "'_" {
+				ref += lifetime + " "
+			}
+		}
+		if c == 'Q' {
+			ref += "mut "
+		}
+		return ref + d.typ()
+	case 'P':
+		d.pos++
+		return "*const " + d.typ()
+	case 'O':
+		d.pos++
+		return "*mut " + d.typ()
+	case 'F':
+		d.pos++
+		return d.fnSig()
+	case 'D':
+		d.pos++
+		bound := d.bound
+		binder := d.binder()
+		traits := make([]string, 0)
+		for !d.consume('E') {
+			traits = append(traits, d.dynTrait())
+		}
+		d.bound = bound
+		if !d.consume('L') {
+			d.fail()
+		}
+		dyn := "dyn " + binder + strings.Join(traits, " + ")
+		if lifetime := d.lifetime(); lifetime != "'_" {
+			dyn += " + " + lifetime
+		}
+		return dyn
+	case 'B':
+		d.pos++
+		return d.backref(d.typ)
+	}
+	return d.path(false)
+}
+
+func (d *rustV0) fnSig() string {
+	bound := d.bound
+	defer func() { d.bound = bound }()
+	prefix := d.binder()
+	if d.consume('U') {
+		prefix += "unsafe "
+	}
+	if d.consume('K') {
+		abi := "C"
+		if !d.consume('C') {
+			_, abi = d.identifier()
+			abi = strings.Replace(abi, "_", "-", -1)
+		}
+		prefix += "extern \"" + abi + "\" "
+	}
+	params := make([]string, 0)
+	for !d.consume('E') {
+		params = append(params, d.typ())
+	}
+	sig := prefix + "fn(" + strings.Join(params, ", ") + ")"
+	if ret := d.typ(); ret != "()" {
+		sig += " -> " + ret
+	}
+	return sig
+}
+
+func (d *rustV0) dynTrait() string {
+	trait := d.path(false)
+	bindings := make([]string, 0)
+	for d.consume('p') {
+		_, name := d.identifier()
+		bindings = append(bindings, name+" = "+d.typ())
+	}
+	if len(bindings) == 0 {
+		return trait
+	}
+	if strings.HasSuffix(trait, ">") {
+		return trait[:len(trait)-1] + ", " + strings.Join(bindings, ", ") + ">"
+	}
+	return trait + "<" + strings.Join(bindings, ", ") + ">"
+}
+
+func (d *rustV0) constant() string {
+	switch {
+	case d.consume('p'):
+		return "_"
+	case d.consume('B'):
+		return d.backref(d.constant)
+	}
+	typ := d.next()
+	neg := false
+	if (typ == 'a' || typ == 's' || typ == 'l' || typ == 'x' || typ == 'n' || typ == 'i') && d.consume('n') {
+		neg = true
+	}
+	start := d.pos
+	for d.peek() != '_' {
+		d.next()
+	}
+	digits := d.s[start:d.pos]
+	d.pos++
+
+	value, ok := new(big.Int).SetString("0"+digits, 16)
+	if !ok {
+		d.fail()
+	}
+	switch typ {
+	case 'b':
+		if value.Sign() == 0 {
+			return "false"
+		}
+		return "true"
+	case 'c':
+		return strconv.QuoteRune(rune(value.Int64()))
+	}
+	if _, exists := rustBasicTypes[typ]; !exists {
+		d.fail()
+	}
+	if neg {
+		value.Neg(value)
+	}
+	return value.String()
+}
+
+// decodePunycode decodes an identifier of the Punycode encoding (RFC 3492)
+// in which the delimiter is '_' instead of '-'.
+func decodePunycode(s string) (string, bool) {
+	const (
+		base        = 36
+		tMin        = 1
+		tMax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+		maxInt      = math.MaxInt32
+	)
+	output := make([]rune, 0, len(s))
+	if idx := strings.LastIndexByte(s, '_'); idx >= 0 {
+		output = append(output, []rune(s[:idx])...)
+		s = s[idx+1:]
+	}
+
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+		k := 0
+		for delta > ((base-tMin)*tMax)/2 {
+			delta /= base - tMin
+			k += base
+		}
+		return k + (base-tMin+1)*delta/(delta+skew)
+	}
+
+	n, i, bias := initialN, 0, initialBias
+	for pos := 0; pos < len(s); {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(s) {
+				return "", false
+			}
+			c := s[pos]
+			pos++
+			var digit int
+			switch {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", false
+			}
+			if digit > (maxInt-i)/w {
+				return "", false
+			}
+			i += digit * w
+			t := k - bias
+			if t < tMin {
+				t = tMin
+			} else if t > tMax {
+				t = tMax
+			}
+			if digit < t {
+				break
+			}
+			if w > maxInt/(base-t) {
+				return "", false
+			}
+			w *= base - t
+		}
+		bias = adapt(i-oldi, len(output)+1, oldi == 0)
+		if i/(len(output)+1) > maxInt-n {
+			return "", false
+		}
+		n += i / (len(output) + 1)
+		if n > utf8.MaxRune {
+			return "", false
+		}
+		i %= len(output) + 1
+		output = append(output[:i], append([]rune{rune(n)}, output[i:]...)...)
+		i++
+	}
+	return string(output), true
+}
@@ -0,0 +1,79 @@
+package binch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDemangle(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"_ZN3foo3barEv", "foo::bar()"},
+		{"_ZNSt6vectorIiSaIiEE9push_backERKi", "std::vector<int, std::allocator<int> >::push_back(int const&)"},
+		{"_Z1fIJidEEvDpT_", "void f<int, double>(int, double)"},
+		{"_ZNKSt8functionIFvvEEclEv", "std::function<void ()>::operator()() const"},
+		{"_Z3maxIiET_S0_S0_", "int max<int>(int, int)"},
+		{"_ZZ4mainENKUlvE_clEv", "main::{lambda()#1}::operator()() const"},
+		{"_ZN12_GLOBAL__N_13fooEv", "(anonymous namespace)::foo()"},
+		{"_ZN3FooC2Ev", "Foo::Foo()"},
+		{"_Z1fPFviE", "f(void (*)(int))"},
+		{"_Z1fA10_i", "f(int [10])"},
+		{"_ZN3foo3barEv@plt", "foo::bar()@plt"},
+		{"_ZN3foo3bar17h05af221e174051e9E", "foo::bar"},
+		{"_RNvNtCs1234_7mycrate3foo3bar", "mycrate::foo::bar"},
+		{"_RNvC6_123foo3bar", "123foo::bar"},
+		{"main", "main"},
+
+		// Malformed names stay mangled.
+		{"_Z1fS" + strings.Repeat("Z", 40) + "_", "_Z1fS" + strings.Repeat("Z", 40) + "_"},
+		{"_Z1fIiET" + strings.Repeat("Z", 20) + "_", "_Z1fIiET" + strings.Repeat("Z", 20) + "_"},
+		{"_Z9223372036854775807a", "_Z9223372036854775807a"},
+		{"_ZN9223372036854775807aE", "_ZN9223372036854775807aE"},
+		{"_RC9223372036854775807a", "_RC9223372036854775807a"},
+		// A backref to itself.
+		{"_RNvB1_3foo", "_RNvB1_3foo"},
+		{"_RNvB" + strings.Repeat("z", 20) + "_3foo", "_RNvB" + strings.Repeat("z", 20) + "_3foo"},
+	}
+	for _, test := range tests {
+		if got := Demangle(test.name); got != test.want {
+			t.Errorf("Demangle(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodePunycode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"caf_dma", "café", true},
+		{"zzzzzzzzzzzzzzzzzzzz", "", false},
+		{"a_99999999999", "", false},
+	}
+	for _, test := range tests {
+		got, ok := decodePunycode(test.in)
+		if got != test.want || ok != test.ok {
+			t.Errorf("decodePunycode(%q) = %q, %v, want %q, %v", test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func FuzzDemangle(f *testing.F) {
+	for _, seed := range []string{
+		"_ZNSt6vectorIiSaIiEE9push_backERKi",
+		"_ZSt4endlIcSt11char_traitsIcEERSt13basic_ostreamIT_T0_ES6_",
+		"_Z1fIJidEEvDpT_",
+		"_ZN3foo3bar17h05af221e174051e9E",
+		"_RNvNtCs1234_7mycrate3foo3bar",
+		"_RNvB1_3foo",
+		"_RCu5_caf_dma",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		Demangle(name)
+	})
+}
@@ -0,0 +1,94 @@
+package binch
+
+import (
+	"debug/elf"
+	"fmt"
+	"github.com/tunz/binch-go/pkg/io"
+)
+
+// The edits of the dynamic section may move tables to new memory at the end
+// of the file, so they are not recorded for undo.
+
+// DynamicEntries returns the entries of the dynamic section.
+func (p *Project) DynamicEntries() ([]bcio.DynEntry, error) {
+	b, err := p.elfFile()
+	if err != nil {
+		return nil, err
+	}
+	return b.DynamicEntries()
+}
+
+// Interpreter returns the program interpreter.
+func (p *Project) Interpreter() (string, error) {
+	b, err := p.elfFile()
+	if err != nil {
+		return "", err
+	}
+	return b.Interpreter()
+}
+
+// SetInterpreter changes the program interpreter.
+func (p *Project) SetInterpreter(path string) error {
+	return p.dynamicEdit(func(b *bcio.Binary) error { return b.SetInterpreter(path) })
+}
+
+// SetSearchPath sets DT_RPATH or DT_RUNPATH. An empty path removes it.
+func (p *Project) SetSearchPath(tag elf.DynTag, path string) error {
+	return p.dynamicEdit(func(b *bcio.Binary) error { return b.SetSearchPath(tag, path) })
+}
+
+// AddNeeded adds a needed library.
+func (p *Project) AddNeeded(lib string) error {
+	return p.dynamicEdit(func(b *bcio.Binary) error { return b.AddNeeded(lib) })
+}
+
+// RemoveNeeded removes a needed library.
+func (p *Project) RemoveNeeded(lib string) error {
+	return p.dynamicEdit(func(b *bcio.Binary) error { return b.RemoveNeeded(lib) })
+}
+
+func (p *Project) dynamicEdit(edit func(b *bcio.Binary) error) error {
+	b, err := p.elfFile()
+	if err != nil {
+		return err
+	}
+	err = edit(b)
+	// Strings and headers may be loaded in memory that is shown.
+	p.invalidateAll()
+	return err
+}
+
+// InjectLibrary adds lib as a needed library. If initAsm is not empty, it is
+// assembled into new executable memory, and the loader calls it before the
+// constructors of the binary. It returns the address of the stub, or 0.
+// Everything that can fail is checked before the binary is changed.
+func (p *Project) InjectLibrary(lib string, initAsm string) (uint64, error) {
+	b, err := p.elfFile()
+	if err != nil {
+		return 0, err
+	}
+	if err := b.CanInject(lib, initAsm != ""); err != nil {
+		return 0, err
+	}
+	if initAsm == "" {
+		return 0, p.AddNeeded(lib)
+	}
+
+	const stubAlign = 16
+	addr, err := b.NextAllocation(stubAlign, elf.PF_R|elf.PF_X)
+	if err != nil {
+		return 0, err
+	}
+	stub := p.Assemble(initAsm, addr)
+	if stub == nil {
+		return 0, fmt.Errorf("invalid assembly: %s", initAsm)
+	}
+	if _, err := b.Allocate(uint64(len(stub)), stubAlign, elf.PF_R|elf.PF_X); err != nil {
+		return 0, err
+	}
+	p.storage.WriteMemory(addr, stub)
+	if err := p.AddNeeded(lib); err != nil {
+		return 0, err
+	}
+	return addr, p.dynamicEdit(func(b *bcio.Binary) error { return b.AddInitFunction(addr) })
+}
@@ -0,0 +1,160 @@
+package binch
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"github.com/tunz/binch-go/pkg/io"
+)
+
+// HookMode is how an imported call is redirected.
+type HookMode int
+
+const (
+	// HookPLT overwrites the PLT stub with a jump to the hook.
+	HookPLT HookMode = iota
+	// HookGOT stores the hook in the GOT slot, and turns the relocation that
+	// fills the slot into a relative one so that the loader keeps it.
+	HookGOT
+)
+
+// relocKinds groups the relocation types of an architecture that matter for
+// hooking.
+type relocKinds struct {
+	jumpSlot uint32
+	globDat  uint32
+	abs      uint32
+	relative uint32
+	name     func(t uint32) string
+}
+
+func (p *Project) relocKinds() (relocKinds, bool) {
+	switch p.storage.Arch() {
+	case "EM_X86_64":
+		return relocKinds{
+			uint32(elf.R_X86_64_JMP_SLOT), uint32(elf.R_X86_64_GLOB_DAT),
+			uint32(elf.R_X86_64_64), uint32(elf.R_X86_64_RELATIVE),
+			func(t uint32) string { return elf.R_X86_64(t).String() },
+		}, true
+	case "EM_386":
+		return relocKinds{
+			uint32(elf.R_386_JMP_SLOT), uint32(elf.R_386_GLOB_DAT),
+			uint32(elf.R_386_32), uint32(elf.R_386_RELATIVE),
+			func(t uint32) string { return elf.R_386(t).String() },
+		}, true
+	case "EM_AARCH64":
+		return relocKinds{
+			uint32(elf.R_AARCH64_JUMP_SLOT), uint32(elf.R_AARCH64_GLOB_DAT),
+			uint32(elf.R_AARCH64_ABS64), uint32(elf.R_AARCH64_RELATIVE),
+			func(t uint32) string { return elf.R_AARCH64(t).String() },
+		}, true
+	}
+	return relocKinds{}, false
+}
+
+// Imports returns the imported symbols that are resolved through GOT slots.
+func (p *Project) Imports() []bcio.Import {
+	if p.elf == nil {
+		return nil
+	}
+	return p.elf.Imports
+}
+
+// RelocName returns the name of a relocation type, e.g. "R_X86_64_JMP_SLOT".
+func (p *Project) RelocName(t uint32) string {
+	if kinds, ok := p.relocKinds(); ok {
+		return kinds.name(t)
+	}
+	return fmt.Sprintf("%d", t)
+}
+
+// HookImport redirects an imported function to target. The change is
+// recorded as a patch, so it is undone at once and written by Save.
+func (p *Project) HookImport(name string, target uint64, mode HookMode) error {
+	kinds, ok := p.relocKinds()
+	if !ok {
+		return fmt.Errorf("hooking is not supported on %s", p.storage.Arch())
+	}
+	imp, ok := p.findImport(name, mode, kinds)
+	if !ok {
+		return fmt.Errorf("no such import: %s", name)
+	}
+	if len(p.storage.ReadMemory(target, 1)) == 0 {
+		return fmt.Errorf("0x%x is not loaded", p.ToDisplay(target))
+	}
+
+	if mode == HookPLT {
+		return p.hookPlt(imp, target, kinds)
+	}
+	return p.hookGot(imp, target, kinds)
+}
+
+// findImport returns the import of a name. A function can be imported through
+// several slots, e.g. when its address is also taken, so the slot that suits
+// the mode is preferred.
+func (p *Project) findImport(name string, mode HookMode, kinds relocKinds) (bcio.Import, bool) {
+	var found bcio.Import
+	exists := false
+	for _, imp := range p.Imports() {
+		if imp.Name != name {
+			continue
+		}
+		if (mode == HookPLT && imp.Plt != 0) || (mode == HookGOT && imp.RelocType == kinds.globDat) {
+			return imp, true
+		}
+		if !exists {
+			found, exists = imp, true
+		}
+	}
+	return found, exists
+}
+
+func (p *Project) hookPlt(imp bcio.Import, target uint64, kinds relocKinds) error {
+	// Stubs in .plt.got jump through slots of GLOB_DAT relocations.
+	if imp.RelocType != kinds.jumpSlot && imp.RelocType != kinds.globDat {
+		return fmt.Errorf("%s has a %s relocation, not a PLT one", imp.Name, kinds.name(imp.RelocType))
+	}
+	if imp.Plt == 0 {
+		return fmt.Errorf("%s has no PLT stub", imp.Name)
+	}
+	jump := "jmp"
+	if p.storage.Arch() == "EM_AARCH64" {
+		jump = "b"
+	}
+	stub := p.assemble(fmt.Sprintf("%s 0x%x", jump, target), imp.Plt)
+	if stub == nil {
+		return fmt.Errorf("cannot jump from 0x%x to 0x%x", p.ToDisplay(imp.Plt), p.ToDisplay(target))
+	}
+	if uint64(len(stub)) > imp.PltSize {
+		return fmt.Errorf("the jump does not fit in the PLT stub of %s", imp.Name)
+	}
+	nop := p.nopBytes()
+	for uint64(len(stub)) < imp.PltSize {
+		stub = append(stub, nop...)
+	}
+	p.WriteMemory(imp.Plt, stub)
+	return nil
+}
+
+func (p *Project) hookGot(imp bcio.Import, target uint64, kinds relocKinds) error {
+	// The loader overwrites JUMP_SLOT entries on every call resolution, and
+	// may reject other relocation types in DT_JMPREL.
+	if imp.RelocType != kinds.globDat && imp.RelocType != kinds.abs {
+		msg := fmt.Sprintf("%s has a %s relocation that cannot hold a hook", imp.Name, kinds.name(imp.RelocType))
+		if imp.RelocType == kinds.jumpSlot {
+			msg += "; hook the PLT stub instead"
+		}
+		return errors.New(msg)
+	}
+	slot := p.elf.EncodeAddress(target)
+	reloc := p.elf.EncodeRelocation(imp, kinds.relative, 0, int64(target))
+	if len(p.storage.ReadMemory(imp.Reloc, uint64(len(reloc)))) != len(reloc) ||
+		len(p.storage.ReadMemory(imp.Slot, uint64(len(slot)))) != len(slot) {
+		return fmt.Errorf("the relocation of %s is not loaded", imp.Name)
+	}
+	// Without an addend, the loader adds the base address to the slot.
+	p.WriteMemory(imp.Reloc, reloc)
+	p.WriteMemory(imp.Slot, slot)
+	p.changes[len(p.changes)-1].joined = true
+	return nil
+}
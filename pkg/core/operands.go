@@ -0,0 +1,113 @@
+package binch
+
+import (
+	"fmt"
+	"github.com/bnagy/gapstone"
+	"sort"
+	"strconv"
+)
+
+const (
+	minPreviewLen = 4  // Shorter strings are likely not strings.
+	maxPreviewLen = 48 // Longer strings are cut in comments.
+)
+
+// Symbolize returns true if operands are annotated with symbols and strings.
+func (p *Project) Symbolize() bool {
+	return p.symbolize
+}
+
+// SetSymbolize turns annotation of operands on or off.
+func (p *Project) SetSymbolize(on bool) {
+	p.symbolize = on
+	p.invalidateAll()
+}
+
+func symbolLabel(name string, off uint64) string {
+	if off == 0 {
+		return "<" + name + ">"
+	}
+	return fmt.Sprintf("<%s+0x%x>", name, off)
+}
+
+// AddrLabel returns the symbol of addr like "<main+0x1a>", or "" if addr is
+// neither in a symbol nor in a function.
+func (p *Project) AddrLabel(addr uint64) string {
+	if name, exists := p.symbolName(addr); exists {
+		return symbolLabel(name, 0)
+	}
+	idx := sort.Search(len(p.sizedSyms), func(i int) bool {
+		return p.sizedSyms[i].Addr > addr
+	}) - 1
+	if idx >= 0 && addr < p.sizedSyms[idx].Addr+p.sizedSyms[idx].Size {
+		symbol := p.sizedSyms[idx]
+		name, _ := p.symbolName(symbol.Addr)
+		return symbolLabel(name, addr-symbol.Addr)
+	}
+	if p.IsCode(addr) {
+		if name, start, ok := p.FindFunction(addr); ok {
+			return symbolLabel(name, addr-start)
+		}
+	}
+	return ""
+}
+
+// targetLabel symbolizes the target of a branch, or the address of a
+// RIP-relative operand.
+func (p *Project) targetLabel(ins *gapstone.Instruction) string {
+	if !p.symbolize || isSkipped(ins) {
+		return ""
+	}
+	if flow := flowOf(ins); (flow.isCall || flow.isJump) && flow.hasTarget {
+		return p.AddrLabel(flow.target)
+	}
+	if ins.X86 != nil {
+		for _, op := range ins.X86.Operands {
+			if op.Type == gapstone.X86_OP_MEM && op.Mem.Base == gapstone.X86_REG_RIP {
+				next := uint64(ins.Address) + uint64(len(ins.Bytes))
+				return p.AddrLabel(next + uint64(op.Mem.Disp))
+			}
+		}
+	}
+	return ""
+}
+
+// stringPreview returns the quoted string at addr, or "" if there is no
+// NUL-terminated string.
+func (p *Project) stringPreview(addr uint64) string {
+	if p.IsCode(addr) {
+		return ""
+	}
+	data := p.storage.ReadMemory(addr, maxPreviewLen+1)
+	n := 0
+	for n < len(data) && isStringChar(data[n]) {
+		n++
+	}
+	if n < minPreviewLen {
+		return ""
+	}
+	if n > maxPreviewLen {
+		return strconv.Quote(string(data[:maxPreviewLen])) + "..."
+	}
+	if n == len(data) || data[n] != 0 {
+		return ""
+	}
+	return strconv.Quote(string(data[:n]))
+}
+
+// commentOf returns the comment of an instruction: a preview of the string
+// that it refers to, or the import that it goes to unless target already
+// names it.
+func (p *Project) commentOf(ins *gapstone.Instruction, target string) string {
+	if p.symbolize {
+		for _, ref := range refsOf(ins) {
+			if preview := p.stringPreview(ref); preview != "" {
+				return preview
+			}
+		}
+	}
+	if target != "" {
+		return ""
+	}
+	return p.importComment(ins)
+}
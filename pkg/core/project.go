@@ -1,6 +1,7 @@
 package binch
 
 import (
+	"errors"
 	"github.com/bnagy/gapstone"
 	"github.com/keystone-engine/keystone/bindings/go/keystone"
 	"github.com/tunz/binch-go/pkg/io"
@@ -9,34 +10,74 @@ import (
 	"strings"
 )
 
-const maxInstrBytes = 15 // Maximum bytes of x86 instructions.
+const (
+	maxInstrBytes   = 15      // Maximum bytes of x86 instructions.
+	chunkSize       = 0x10000 // Code is disassembled in chunks of about this size.
+	maxCachedChunks = 64
+)
 
 type addrIdxInfo struct {
-	SectionBase uint64
-	ArrIdx      int
+	ChunkBase uint64
+	ArrIdx    int
 }
 
 type changeInfo struct {
 	addr uint64
 	data []byte
+	// inFile means that addr is a file offset, e.g. of a header field.
+	inFile bool
+	// joined means that the change is undone together with the previous one.
+	joined bool
 }
 
+// errNotELF is returned by features that only ELF files have.
+var errNotELF = errors.New("not an ELF file")
+
 // Project groups binary and assembly engines.
 type Project struct {
-	binary       *bcio.Binary
+	storage bcio.Storage
+	// elf is storage if it is an ELF file, core file or process that bcio
+	// loads, or nil. Headers, the dynamic section and relocations need it.
+	elf          *bcio.Binary
 	assembler    *keystone.Keystone
 	disassembler *gapstone.Engine
-	section2code map[uint64][]*Instruction
+	chunk2code   map[uint64][]*Instruction
+	chunkOrder   []uint64            // Cached chunks from the least recently used.
+	chunkBases   map[uint64][]uint64 // Chunk starts by code section.
 	addr2idx     map[uint64]addrIdxInfo
 	changes      []changeInfo
+	funcStarts   []uint64
+	seeds        []uint64        // Known function starts, see functionSeeds.
+	analyzed     map[uint64]bool // Analyzed code sections by start.
+	regions      []region
+	xrefs        map[uint64][]uint64
+	imports      map[uint64]string
+	rawNames     bool
+	demangled    map[string]string
+	symbolize    bool
+	sizedSyms    []bcio.Symbol
+	labels       map[uint64]string
+	comments     map[uint64]string
+	bookmarks    map[string]uint64
+	displayBase  uint64
+	displayDelta uint64
+	// annotationPath is the project file of labels and comments.
+	annotationPath string
 }
 
-// Instruction is a simplified struct of gapstone.Instruction
+// Instruction is a simplified struct of gapstone.Instruction. It is also used
+// for data lines in the listing, which have a Type other than CodeType.
 type Instruction struct {
 	Name    string
 	Address uint64
 	Bytes   []byte
 	Str     string
+	Type    DataType
+	Target  string // Symbolized operand, e.g. "<main+0x1a>".
+	Comment string
+	Note    string // User comment.
+	imms    []int64
+	refs    []uint64
 }
 
 // MakeAssembler creates a keystone engine.
@@ -74,145 +115,282 @@ func makeDisassembler(machineType string) *gapstone.Engine {
 	if err != nil {
 		panic(err)
 	}
+	// Details are needed to follow the control flow.
+	if err := cs.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+		panic(err)
+	}
+	// Undecodable bytes become ".byte" lines instead of stopping disassembly.
+	cs.SkipDataStart(nil)
 	return &cs
 }
 
+// isSkipped returns true if ins is a ".byte" line emitted by skipdata mode.
+func isSkipped(ins *gapstone.Instruction) bool {
+	return ins.Id == 0
+}
+
 func (p *Project) makeInstruction(ins gapstone.Instruction) *Instruction {
-	opStr := ins.Mnemonic + " " + ins.OpStr
+	opStr := ins.Mnemonic + " " + p.displayOperands(&ins)
 	addr := uint64(ins.Address)
-	symbolName := p.binary.Addr2Symbol[addr]
+	typ := CodeType
+	if isSkipped(&ins) {
+		typ = ByteType
+	}
+	target := p.targetLabel(&ins)
 	return &Instruction{
-		Name:    symbolName,
+		Name:    p.labelOf(addr),
 		Address: addr,
 		Bytes:   ins.Bytes,
 		Str:     opStr,
+		Type:    typ,
+		Target:  target,
+		Comment: p.commentOf(&ins, target),
+		Note:    p.comments[addr],
+		imms:    immsOf(&ins),
+		refs:    refsOf(&ins),
 	}
 }
 
-func (p *Project) disasmAll(sectionBase uint64, size uint64) []*Instruction {
-	buf := p.binary.ReadMemory(sectionBase, size)
-	if buf == nil {
+func (p *Project) disasmCode(addr uint64, size uint64) []*Instruction {
+	buf := p.storage.ReadMemory(addr, size)
+	if len(buf) == 0 {
 		return nil
 	}
-	insns, err := p.disassembler.Disasm(buf, sectionBase, 0)
+	insns, err := p.disassembler.Disasm(buf, addr, 0)
 	if err != nil {
 		return nil
 	}
 
 	result := make([]*Instruction, 0, len(insns))
-	for idx, ins := range insns {
+	for _, ins := range insns {
 		result = append(result, p.makeInstruction(ins))
-		p.addr2idx[uint64(ins.Address)] = addrIdxInfo{
-			SectionBase: sectionBase,
-			ArrIdx:      idx,
+	}
+	return result
+}
+
+// disasmRange disassembles [start, end), and shows data regions as data
+// lines.
+func (p *Project) disasmRange(start uint64, end uint64) []*Instruction {
+	result := make([]*Instruction, 0)
+	addr := start
+	for _, r := range p.regionsIn(start, end) {
+		if addr < r.start {
+			result = append(result, p.disasmCode(addr, r.start-addr)...)
 		}
+		result = append(result, p.dataLines(r)...)
+		addr = r.end
+	}
+	if addr < end {
+		result = append(result, p.disasmCode(addr, end-addr)...)
 	}
 	return result
 }
 
 func (p *Project) findSectionIdx(addr uint64) int {
-	return sort.Search(len(p.binary.CodeSections), func(i int) bool {
-		return p.binary.CodeSections[i].Addr > addr
+	return sort.Search(len(p.storage.CodeRegions()), func(i int) bool {
+		return p.storage.CodeRegions()[i].Addr > addr
 	}) - 1
 }
 
-func (p *Project) getSectionCodeFromBase(base uint64) []*Instruction {
-	if code, exists := p.section2code[base]; exists {
+// sectionChunks returns the starts of the chunks of a code section. A chunk
+// ends at the first function start or region boundary after chunkSize bytes,
+// where an instruction is known to start, so that chunks are disassembled
+// independently.
+func (p *Project) sectionChunks(sectionIdx int) []uint64 {
+	section := p.storage.CodeRegions()[sectionIdx]
+	if bases, exists := p.chunkBases[section.Addr]; exists {
+		return bases
+	}
+	p.analyzeSection(sectionIdx)
+	end := section.Addr + section.Size
+	syncs := make([]uint64, 0)
+	for _, addr := range p.funcStarts {
+		if addr > section.Addr && addr < end {
+			syncs = append(syncs, addr)
+		}
+	}
+	for _, r := range p.regionsIn(section.Addr, end) {
+		syncs = append(syncs, r.start, r.end)
+	}
+	sort.Slice(syncs, func(i, j int) bool { return syncs[i] < syncs[j] })
+
+	bases := []uint64{section.Addr}
+	for next := section.Addr + chunkSize; next < end; next += chunkSize {
+		idx := sort.Search(len(syncs), func(i int) bool { return syncs[i] >= next })
+		if idx == len(syncs) || syncs[idx] >= end {
+			break
+		}
+		if syncs[idx] > bases[len(bases)-1] {
+			bases = append(bases, syncs[idx])
+		}
+	}
+	p.chunkBases[section.Addr] = bases
+	return bases
+}
+
+// findChunk returns the section and the index of the chunk that contains
+// addr.
+func (p *Project) findChunk(addr uint64) (int, int, bool) {
+	sectionIdx := p.findSectionIdx(addr)
+	if sectionIdx < 0 {
+		return 0, 0, false
+	}
+	section := p.storage.CodeRegions()[sectionIdx]
+	if addr >= section.Addr+section.Size {
+		return 0, 0, false
+	}
+	bases := p.sectionChunks(sectionIdx)
+	return sectionIdx, sort.Search(len(bases), func(i int) bool { return bases[i] > addr }) - 1, true
+}
+
+// chunkEnd returns the end of a chunk.
+func (p *Project) chunkEnd(sectionIdx int, chunkIdx int) uint64 {
+	if bases := p.sectionChunks(sectionIdx); chunkIdx+1 < len(bases) {
+		return bases[chunkIdx+1]
+	}
+	section := p.storage.CodeRegions()[sectionIdx]
+	return section.Addr + section.Size
+}
+
+// getChunk returns the lines of a chunk, and disassembles it if it is not
+// cached. Only the recently used chunks are kept.
+func (p *Project) getChunk(sectionIdx int, chunkIdx int) []*Instruction {
+	base := p.sectionChunks(sectionIdx)[chunkIdx]
+	if code, exists := p.chunk2code[base]; exists {
+		p.touchChunk(base)
 		return code
 	}
 
-	sectionIdx := p.findSectionIdx(base)
-	size := p.binary.CodeSections[sectionIdx].Size
-	p.section2code[base] = p.disasmAll(base, size)
-	return p.section2code[base]
+	if len(p.chunkOrder) >= maxCachedChunks {
+		p.dropChunk(p.chunkOrder[0])
+	}
+	code := p.disasmRange(base, p.chunkEnd(sectionIdx, chunkIdx))
+	for idx, ins := range code {
+		p.addr2idx[ins.Address] = addrIdxInfo{ChunkBase: base, ArrIdx: idx}
+	}
+	p.chunk2code[base] = code
+	p.chunkOrder = append(p.chunkOrder, base)
+	return code
 }
 
-func (p *Project) findSectionCode(addr uint64) []*Instruction {
-	idx := p.findSectionIdx(addr)
-	if idx < 0 {
-		return nil
+// indexOf returns the chunk and the index of the line at addr, and loads
+// the chunk if it is dropped from the cache.
+func (p *Project) indexOf(addr uint64) (int, int, addrIdxInfo, bool) {
+	sectionIdx, chunkIdx, ok := p.findChunk(addr)
+	if !ok {
+		return 0, 0, addrIdxInfo{}, false
 	}
-	base := p.binary.CodeSections[idx].Addr
-	sz := p.binary.CodeSections[idx].Size
-	if addr < base || addr >= base+sz {
-		return nil
+	p.getChunk(sectionIdx, chunkIdx)
+	info, exists := p.addr2idx[addr]
+	return sectionIdx, chunkIdx, info, exists
+}
+
+// scanCode calls fn for every line of every code section until it returns
+// false. Chunks that are not cached are not added to the cache, so that a
+// scan does not keep the whole program in memory.
+func (p *Project) scanCode(fn func(instr *Instruction) bool) {
+	for sectionIdx := range p.storage.CodeRegions() {
+		for chunkIdx, base := range p.sectionChunks(sectionIdx) {
+			code, exists := p.chunk2code[base]
+			if !exists {
+				code = p.disasmRange(base, p.chunkEnd(sectionIdx, chunkIdx))
+			}
+			for _, instr := range code {
+				if !fn(instr) {
+					return
+				}
+			}
+		}
 	}
-	return p.getSectionCodeFromBase(base)
 }
 
 // FindPrevInstruction finds a previous instruction by checking every code
 // section.
 func (p *Project) FindPrevInstruction(addr uint64) *Instruction {
-	info, exists := p.addr2idx[addr]
+	sectionIdx, chunkIdx, info, exists := p.indexOf(addr)
 	if !exists {
 		log.Panicln("FindPrevInstructions is called from unknown address.")
 	}
+	if info.ArrIdx > 0 {
+		return p.chunk2code[info.ChunkBase][info.ArrIdx-1]
+	}
 
-	if info.SectionBase == addr {
-		sectionIdx := p.findSectionIdx(addr)
-		if p.binary.CodeSections[sectionIdx].Addr != addr {
-			log.Panicln("p.binary.CodeSections[sectionIdx].Addr != addr")
+	for chunkIdx--; ; chunkIdx-- {
+		for chunkIdx < 0 {
+			if sectionIdx--; sectionIdx < 0 {
+				return nil
+			}
+			chunkIdx = len(p.sectionChunks(sectionIdx)) - 1
 		}
-		if sectionIdx == 0 {
-			return nil
+		if code := p.getChunk(sectionIdx, chunkIdx); len(code) != 0 {
+			return code[len(code)-1]
 		}
-		base := p.binary.CodeSections[sectionIdx-1].Addr
-		code := p.getSectionCodeFromBase(base)
-		return code[len(code)-1]
 	}
-
-	code := p.getSectionCodeFromBase(info.SectionBase)
-	return code[info.ArrIdx-1]
 }
 
 // FindNextInstruction finds a next instruction by checking every code
 // section.
 func (p *Project) FindNextInstruction(addr uint64) *Instruction {
-	info, exists := p.addr2idx[addr]
+	sectionIdx, chunkIdx, info, exists := p.indexOf(addr)
 	if !exists {
 		log.Panicln("FindNextInstructions is called from unknown address.")
 	}
+	if code := p.chunk2code[info.ChunkBase]; info.ArrIdx+1 < len(code) {
+		return code[info.ArrIdx+1]
+	}
 
-	code := p.getSectionCodeFromBase(info.SectionBase)
-	if info.ArrIdx == len(code)-1 {
-		sectionIdx := sort.Search(len(p.binary.CodeSections), func(i int) bool {
-			return p.binary.CodeSections[i].Addr >= info.SectionBase
-		})
-		if p.binary.CodeSections[sectionIdx].Addr != info.SectionBase {
-			log.Panicln("p.binary.CodeSections[sectionIdx].Addr != infoSectionBase")
+	for chunkIdx++; ; chunkIdx++ {
+		for chunkIdx >= len(p.sectionChunks(sectionIdx)) {
+			if sectionIdx++; sectionIdx >= len(p.storage.CodeRegions()) {
+				return nil
+			}
+			chunkIdx = 0
 		}
-		if sectionIdx+1 == len(p.binary.CodeSections) {
-			return nil
+		if code := p.getChunk(sectionIdx, chunkIdx); len(code) != 0 {
+			return code[0]
 		}
-		base := p.binary.CodeSections[sectionIdx+1].Addr
-		code := p.getSectionCodeFromBase(base)
-		return code[0]
 	}
-
-	return code[info.ArrIdx+1]
 }
 
-// GetInstruction find and returns an instruction.
+// GetInstruction find and returns an instruction. If addr is not the start
+// of an instruction, it returns the instruction that covers addr or the next
+// one.
 func (p *Project) GetInstruction(addr uint64) *Instruction {
 	if info, exists := p.addr2idx[addr]; exists {
-		code := p.getSectionCodeFromBase(info.SectionBase)
-		return code[info.ArrIdx]
+		p.touchChunk(info.ChunkBase)
+		return p.chunk2code[info.ChunkBase][info.ArrIdx]
+	}
+	sectionIdx, chunkIdx, ok := p.findChunk(addr)
+	if !ok {
+		return nil
 	}
-	code := p.findSectionCode(addr)
-	if code == nil {
+	code := p.getChunk(sectionIdx, chunkIdx)
+	if len(code) == 0 {
 		return nil
 	}
-	info := p.addr2idx[addr]
-	return code[info.ArrIdx]
+	idx := sort.Search(len(code), func(i int) bool {
+		return code[i].Address+uint64(len(code[i].Bytes)) > addr
+	})
+	if idx == len(code) {
+		return p.FindNextInstruction(code[len(code)-1].Address)
+	}
+	return code[idx]
 }
 
 // Entry returns binary entry point.
 func (p *Project) Entry() uint64 {
-	return p.binary.Entry
+	return p.storage.EntryPoint()
 }
 
-// Assemble returns byte codes of a given instruction.
+// Assemble returns byte codes of a given instruction at addr. Addresses in
+// instr are displayed ones, so they are relative to the display base.
 func (p *Project) Assemble(instr string, addr uint64) []byte {
+	return p.assemble(instr, p.ToDisplay(addr))
+}
+
+// assemble returns byte codes of an instruction whose addresses are file
+// addresses.
+func (p *Project) assemble(instr string, addr uint64) []byte {
 	// LLVM has some weird syntax check. It does not catch syntax errors for
 	// mismatched brackets. So, we catch them here.
 	if strings.Count(instr, "[") != strings.Count(instr, "]") {
@@ -227,7 +405,7 @@ func (p *Project) Assemble(instr string, addr uint64) []byte {
 
 // Disassemble returns an instruction of a given byte code.
 func (p *Project) Disassemble(buf []byte, addr uint64) *Instruction {
-	if insns, err := p.disassembler.Disasm(buf, addr, 1); err == nil {
+	if insns, err := p.disassembler.Disasm(buf, addr, 1); err == nil && !isSkipped(&insns[0]) {
 		return p.makeInstruction(insns[0])
 	}
 	return nil
@@ -239,18 +417,179 @@ func copyData(data []byte) []byte {
 	return newData
 }
 
+// ReadMemory returns a copy of memory bytes.
+func (p *Project) ReadMemory(addr uint64, size uint64) []byte {
+	return copyData(p.storage.ReadMemory(addr, size))
+}
+
+// ReadError returns the last failure to read memory, e.g. of a process that
+// exited, or nil.
+func (p *Project) ReadError() error {
+	if p.elf == nil {
+		return nil
+	}
+	return p.elf.ReadError()
+}
+
+// elfFile returns the ELF file of the project, or an error for other storage.
+func (p *Project) elfFile() (*bcio.Binary, error) {
+	if p.elf == nil {
+		return nil, errNotELF
+	}
+	return p.elf, nil
+}
+
+// Sections returns the section headers of the binary.
+func (p *Project) Sections() []bcio.Section {
+	if p.elf == nil {
+		return nil
+	}
+	return p.elf.Sections
+}
+
+// ProgHeaders returns the program headers of the binary.
+func (p *Project) ProgHeaders() []bcio.ProgHeader {
+	if p.elf == nil {
+		return nil
+	}
+	return p.elf.ProgHeaders
+}
+
+// HeaderCount returns the number of headers of a kind.
+func (p *Project) HeaderCount(kind bcio.HeaderKind) int {
+	if p.elf == nil {
+		return 0
+	}
+	return p.elf.HeaderCount(kind)
+}
+
+// HeaderFields returns the fields of an ELF header.
+func (p *Project) HeaderFields(kind bcio.HeaderKind, idx int) ([]bcio.HeaderField, error) {
+	b, err := p.elfFile()
+	if err != nil {
+		return nil, err
+	}
+	return b.HeaderFields(kind, idx)
+}
+
+// SetHeaderField changes a field of an ELF header. It can be undone like
+// other patches.
+func (p *Project) SetHeaderField(kind bcio.HeaderKind, idx int, name string, value uint64) error {
+	b, err := p.elfFile()
+	if err != nil {
+		return err
+	}
+	field, err := b.HeaderField(kind, idx, name)
+	if err != nil {
+		return err
+	}
+	origData := copyData(b.ReadFile(field.Offset, field.Size))
+	if err := b.SetHeaderField(kind, idx, name, value); err != nil {
+		return err
+	}
+	p.changes = append(p.changes, changeInfo{addr: uint64(field.Offset), data: origData, inFile: true})
+	// Headers may be loaded in memory that is shown.
+	p.invalidateAll()
+	return nil
+}
+
+// MemoryRange is a range of memory that is backed by the file.
+type MemoryRange struct {
+	Start uint64
+	End   uint64
+}
+
+// MemoryRanges returns sorted memory ranges of loaded segments. Segments are
+// loaded by pages, so overlapping ones are merged.
+func (p *Project) MemoryRanges() []MemoryRange {
+	segments := p.storage.Segments()
+	ranges := make([]MemoryRange, 0, len(segments))
+	for _, s := range segments {
+		if s.Size != 0 {
+			ranges = append(ranges, MemoryRange{Start: s.Vaddr, End: s.Vaddr + s.Size})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+
+	merged := make([]MemoryRange, 0, len(ranges))
+	for _, r := range ranges {
+		if last := len(merged) - 1; last >= 0 && r.Start <= merged[last].End {
+			if r.End > merged[last].End {
+				merged[last].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
 // WriteMemory write data into memory, and remove code caches if necessary.
-func (p *Project) WriteMemory(addr uint64, data []byte) {
-	origData := copyData(p.binary.ReadMemory(addr, uint64(len(data))))
+// It returns the dynamic relocations that overwrite the data at load time.
+func (p *Project) WriteMemory(addr uint64, data []byte) []bcio.Relocation {
+	origData := copyData(p.storage.ReadMemory(addr, uint64(len(data))))
 	p.changes = append(p.changes, changeInfo{addr: addr, data: origData})
 	p.recWriteMemory(addr, data)
+	return p.RelocationsAt(addr, uint64(len(data)))
+}
+
+// touchChunk moves a cached chunk to the end of chunkOrder, so that the
+// least recently used chunk is dropped first.
+func (p *Project) touchChunk(base uint64) {
+	for i, cached := range p.chunkOrder {
+		if cached == base {
+			p.chunkOrder = append(append(p.chunkOrder[:i], p.chunkOrder[i+1:]...), base)
+			return
+		}
+	}
+}
+
+// dropChunk drops the cached lines of a chunk.
+func (p *Project) dropChunk(base uint64) {
+	for _, instr := range p.chunk2code[base] {
+		delete(p.addr2idx, instr.Address)
+	}
+	delete(p.chunk2code, base)
+	for i, cached := range p.chunkOrder {
+		if cached == base {
+			p.chunkOrder = append(p.chunkOrder[:i], p.chunkOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// invalidateSection drops the cached code of a section. Patches may change
+// instruction boundaries, so the address index and the chunks are dropped
+// as well.
+func (p *Project) invalidateSection(base uint64) {
+	end := base
+	if idx := p.findSectionIdx(base); idx >= 0 {
+		section := p.storage.CodeRegions()[idx]
+		end = section.Addr + section.Size
+	}
+	for _, cached := range append([]uint64{}, p.chunkOrder...) {
+		if cached >= base && cached < end {
+			p.dropChunk(cached)
+		}
+	}
+	delete(p.chunkBases, base)
+	p.xrefs = nil
+}
+
+// invalidateAll drops the cached code of every section, e.g. when the way
+// that labels and operands are shown changes.
+func (p *Project) invalidateAll() {
+	for _, section := range p.storage.CodeRegions() {
+		p.invalidateSection(section.Addr)
+	}
 }
 
 func (p *Project) recWriteMemory(addr uint64, data []byte) {
-	sectionIdx := p.findSectionIdx(addr)
-	delete(p.section2code, p.binary.CodeSections[sectionIdx].Addr)
-	r := p.binary.WriteMemory(addr, data)
-	if r < len(data) {
+	if sectionIdx := p.findSectionIdx(addr); sectionIdx >= 0 {
+		p.invalidateSection(p.storage.CodeRegions()[sectionIdx].Addr)
+	}
+	r := p.storage.WriteMemory(addr, data)
+	if r > 0 && r < len(data) {
 		p.recWriteMemory(addr+uint64(r), data[r:])
 	}
 }
@@ -262,22 +601,53 @@ func (p *Project) Undo() {
 	}
 	last := p.changes[len(p.changes)-1]
 	p.changes = p.changes[:len(p.changes)-1]
-	p.recWriteMemory(last.addr, last.data)
+	if last.inFile {
+		// Only changes of ELF headers are in the file.
+		p.elf.WriteFile(int64(last.addr), last.data)
+		p.invalidateAll()
+	} else {
+		p.recWriteMemory(last.addr, last.data)
+	}
+	if last.joined {
+		p.Undo()
+	}
 }
 
-// Save just calls the save method of binary.
-func (p *Project) Save() {
-	p.binary.Save()
+// Save writes the patches to the storage.
+func (p *Project) Save() error {
+	return p.storage.Commit()
 }
 
 // MakeProject creates a binch project object.
-func MakeProject(b *bcio.Binary) *Project {
-	return &Project{
-		binary:       b,
-		assembler:    makeAssembler(b.MachineType),
-		disassembler: makeDisassembler(b.MachineType),
-		section2code: make(map[uint64][]*Instruction),
+func MakeProject(s bcio.Storage) *Project {
+	elfFile, _ := s.(*bcio.Binary)
+	p := &Project{
+		storage:      s,
+		elf:          elfFile,
+		assembler:    makeAssembler(s.Arch()),
+		disassembler: makeDisassembler(s.Arch()),
+		chunk2code:   make(map[uint64][]*Instruction),
+		chunkBases:   make(map[uint64][]uint64),
 		addr2idx:     make(map[uint64]addrIdxInfo),
+		analyzed:     make(map[uint64]bool),
 		changes:      make([]changeInfo, 0),
+		imports:      make(map[uint64]string),
+		demangled:    make(map[string]string),
+		symbolize:    true,
+		sizedSyms:    make([]bcio.Symbol, 0),
+		labels:       make(map[uint64]string),
+		comments:     make(map[uint64]string),
+		bookmarks:    make(map[string]uint64),
+	}
+	for _, symbol := range s.SymbolList() {
+		if symbol.Kind == bcio.ImportSymbol {
+			p.imports[symbol.Addr] = symbol.Name
+		}
+		if symbol.Size > 0 {
+			p.sizedSyms = append(p.sizedSyms, symbol)
+		}
 	}
+	sort.Slice(p.sizedSyms, func(i, j int) bool { return p.sizedSyms[i].Addr < p.sizedSyms[j].Addr })
+	p.seeds = p.functionSeeds()
+	return p
 }
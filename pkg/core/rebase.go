@@ -0,0 +1,71 @@
+package binch
+
+import (
+	"fmt"
+	"github.com/bnagy/gapstone"
+	"strings"
+)
+
+const pageSize = 0x1000
+
+// imageBase returns the page of the lowest loaded segment, which is where the
+// loader puts the display base.
+func (p *Project) imageBase() uint64 {
+	ranges := p.MemoryRanges()
+	if len(ranges) == 0 {
+		return 0
+	}
+	return ranges[0].Start &^ (pageSize - 1)
+}
+
+// DisplayBase returns the address that the binary is shown loaded at, or 0
+// if addresses are shown as in the file.
+func (p *Project) DisplayBase() uint64 {
+	return p.displayBase
+}
+
+// SetDisplayBase shows the binary as loaded at base, e.g. at the runtime base
+// of a PIE binary in a debugger. Addresses are still stored as in the file;
+// 0 shows them as in the file again.
+func (p *Project) SetDisplayBase(base uint64) {
+	p.displayBase = base
+	p.displayDelta = 0
+	if base != 0 {
+		// Addresses below the image base wrap around, like negative deltas.
+		p.displayDelta = base - p.imageBase()
+	}
+	p.invalidateAll()
+}
+
+// ToDisplay converts a file address to a displayed one.
+func (p *Project) ToDisplay(addr uint64) uint64 {
+	return addr + p.displayDelta
+}
+
+// FromDisplay converts a displayed or entered address to a file address.
+func (p *Project) FromDisplay(addr uint64) uint64 {
+	return addr - p.displayDelta
+}
+
+// displayOperands returns the operands of ins with branch targets shifted to
+// the display base. Other immediates may be sizes or offsets, and
+// RIP-relative displacements do not depend on the base, so they are kept.
+func (p *Project) displayOperands(ins *gapstone.Instruction) string {
+	if p.displayDelta == 0 || isSkipped(ins) {
+		return ins.OpStr
+	}
+	flow := flowOf(ins)
+	target, ok := flow.target, flow.hasTarget
+	if ins.Arm64 != nil && (ins.Mnemonic == "adr" || ins.Mnemonic == "adrp") {
+		target, ok = immTarget(ins)
+	}
+	if !ok {
+		return ins.OpStr
+	}
+	old := fmt.Sprintf("0x%x", target)
+	idx := strings.LastIndex(ins.OpStr, old)
+	if idx < 0 {
+		return ins.OpStr
+	}
+	return ins.OpStr[:idx] + fmt.Sprintf("0x%x", p.ToDisplay(target)) + ins.OpStr[idx+len(old):]
+}
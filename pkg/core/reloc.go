@@ -0,0 +1,67 @@
+package binch
+
+import (
+	"fmt"
+	"github.com/tunz/binch-go/pkg/io"
+)
+
+// RelocationsAt returns the dynamic relocations that write into
+// [addr, addr+size) at load time.
+func (p *Project) RelocationsAt(addr uint64, size uint64) []bcio.Relocation {
+	if p.elf == nil {
+		return nil
+	}
+	return p.elf.RelocationsAt(addr, size)
+}
+
+// RelocDesc describes a relocation, e.g. "R_X86_64_RELATIVE 0x4010 +0x1139".
+func (p *Project) RelocDesc(reloc bcio.Relocation) string {
+	desc := fmt.Sprintf("%s 0x%x", p.RelocName(reloc.Type), p.ToDisplay(reloc.Offset))
+	switch {
+	case reloc.Relr:
+		desc += " (DT_RELR)"
+	case reloc.Rela:
+		desc += fmt.Sprintf(" %+#x", reloc.Addend)
+	}
+	return desc
+}
+
+// applyPatches writes patches that are undone at once.
+func (p *Project) applyPatches(patches []bcio.Patch) {
+	for i, patch := range patches {
+		p.WriteMemory(patch.Addr, patch.Data)
+		if i > 0 {
+			p.changes[len(p.changes)-1].joined = true
+		}
+	}
+}
+
+// RemoveRelocation turns a relocation into R_*_NONE, so that a patch at its
+// target is kept at load time. It can be undone like other patches.
+func (p *Project) RemoveRelocation(reloc bcio.Relocation) error {
+	b, err := p.elfFile()
+	if err != nil {
+		return err
+	}
+	patches, err := b.RemoveRelocation(reloc)
+	if err != nil {
+		return err
+	}
+	p.applyPatches(patches)
+	return nil
+}
+
+// AdjustRelocation makes a relative relocation relocate the patched address
+// at its target. It can be undone like other patches.
+func (p *Project) AdjustRelocation(reloc bcio.Relocation) error {
+	b, err := p.elfFile()
+	if err != nil {
+		return err
+	}
+	patches, err := b.AdjustRelocation(reloc)
+	if err != nil {
+		return err
+	}
+	p.applyPatches(patches)
+	return nil
+}
@@ -0,0 +1,153 @@
+package binch
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SearchMode selects how a search query is interpreted.
+type SearchMode int
+
+// Search modes.
+const (
+	BytesSearch SearchMode = iota
+	InstrSearch
+	ImmSearch
+)
+
+var searchModeNames = []string{"bytes", "instr", "imm"}
+
+func (m SearchMode) String() string {
+	return searchModeNames[m]
+}
+
+// Next returns the next search mode in cycle.
+func (m SearchMode) Next() SearchMode {
+	return (m + 1) % SearchMode(len(searchModeNames))
+}
+
+// SearchHit is an address found by a search.
+type SearchHit struct {
+	Address uint64
+	Text    string
+}
+
+const maxSearchHits = 10000
+
+// parseBytePattern parses hex bytes such as "48 8b ?? ?? e8". Wildcard bytes
+// are returned as -1.
+func parseBytePattern(query string) ([]int, error) {
+	stripped := strings.Join(strings.Fields(query), "")
+	if len(stripped) == 0 || len(stripped)%2 != 0 {
+		return nil, errors.New("byte pattern needs pairs of hex digits")
+	}
+	pattern := make([]int, 0, len(stripped)/2)
+	for i := 0; i < len(stripped); i += 2 {
+		token := stripped[i : i+2]
+		if token == "??" {
+			pattern = append(pattern, -1)
+			continue
+		}
+		b, err := strconv.ParseUint(token, 16, 8)
+		if err != nil {
+			return nil, errors.New("invalid byte: " + token)
+		}
+		pattern = append(pattern, int(b))
+	}
+	return pattern, nil
+}
+
+func matchPattern(data []byte, pattern []int) bool {
+	for i, b := range pattern {
+		if b != -1 && int(data[i]) != b {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Project) searchBytes(query string) ([]SearchHit, error) {
+	pattern, err := parseBytePattern(query)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]SearchHit, 0)
+	for _, r := range p.MemoryRanges() {
+		data := p.storage.ReadMemory(r.Start, r.End-r.Start)
+		for i := 0; i+len(pattern) <= len(data) && len(hits) < maxSearchHits; i++ {
+			if matchPattern(data[i:], pattern) {
+				addr := r.Start + uint64(i)
+				hits = append(hits, SearchHit{Address: addr, Text: p.hitText(addr)})
+			}
+		}
+	}
+	return hits, nil
+}
+
+// hitText describes an address found by searching memory.
+func (p *Project) hitText(addr uint64) string {
+	if !p.IsCode(addr) {
+		return ""
+	}
+	if instr := p.GetInstruction(addr); instr != nil {
+		return instr.Str
+	}
+	return ""
+}
+
+// searchCode calls match for every line of every code section.
+func (p *Project) searchCode(match func(instr *Instruction) bool) []SearchHit {
+	hits := make([]SearchHit, 0)
+	p.scanCode(func(instr *Instruction) bool {
+		if match(instr) {
+			hits = append(hits, SearchHit{Address: instr.Address, Text: instr.Str})
+		}
+		return len(hits) < maxSearchHits
+	})
+	return hits
+}
+
+func (p *Project) searchInstr(query string) ([]SearchHit, error) {
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return p.searchCode(func(instr *Instruction) bool {
+		return instr.Type == CodeType && re.MatchString(instr.Str)
+	}), nil
+}
+
+func (p *Project) searchImm(query string) ([]SearchHit, error) {
+	query = strings.TrimSpace(query)
+	var val uint64
+	if signed, err := strconv.ParseInt(query, 0, 64); err == nil {
+		val = uint64(signed)
+	} else if val, err = strconv.ParseUint(query, 0, 64); err != nil {
+		return nil, errors.New("invalid value: " + query)
+	}
+	return p.searchCode(func(instr *Instruction) bool {
+		for _, imm := range instr.imms {
+			if uint64(imm) == val {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// Search finds addresses matching query. Bytes search scans every loaded
+// segment, and the others scan the disassembly of code sections.
+func (p *Project) Search(mode SearchMode, query string) ([]SearchHit, error) {
+	switch mode {
+	case BytesSearch:
+		return p.searchBytes(query)
+	case InstrSearch:
+		return p.searchInstr(query)
+	case ImmSearch:
+		return p.searchImm(query)
+	}
+	return nil, errors.New("unknown search mode")
+}
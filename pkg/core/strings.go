@@ -0,0 +1,138 @@
+package binch
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// StringEncoding is the encoding of a string found in memory.
+type StringEncoding int
+
+// String encodings.
+const (
+	ASCIIString StringEncoding = iota
+	UTF16String
+)
+
+// FoundString is a NUL-terminated string found in loaded segments.
+type FoundString struct {
+	Address  uint64
+	Size     uint64 // Bytes without the terminator.
+	Text     string
+	Encoding StringEncoding
+}
+
+func isStringChar(b byte) bool {
+	return (b >= 0x20 && b < 0x7f) || b == '\t' || b == '\n' || b == '\r'
+}
+
+func asciiStrings(base uint64, data []byte, minLen int) []FoundString {
+	found := make([]FoundString, 0)
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && isStringChar(data[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minLen {
+			found = append(found, FoundString{
+				Address:  base + uint64(start),
+				Size:     uint64(i - start),
+				Text:     string(data[start:i]),
+				Encoding: ASCIIString,
+			})
+		}
+		start = -1
+	}
+	return found
+}
+
+func utf16Strings(base uint64, data []byte, minLen int) []FoundString {
+	found := make([]FoundString, 0)
+	for parity := 0; parity < 2; parity++ {
+		start := -1
+		for i := parity; i <= len(data); i += 2 {
+			if i+1 < len(data) && isStringChar(data[i]) && data[i+1] == 0 {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if start >= 0 && (i-start)/2 >= minLen {
+				text := make([]byte, 0, (i-start)/2)
+				for j := start; j < i; j += 2 {
+					text = append(text, data[j])
+				}
+				found = append(found, FoundString{
+					Address:  base + uint64(start),
+					Size:     uint64(i - start),
+					Text:     string(text),
+					Encoding: UTF16String,
+				})
+			}
+			start = -1
+		}
+	}
+	return found
+}
+
+// Strings extracts ASCII and UTF-16LE strings of at least minLen characters
+// from every loaded segment.
+func (p *Project) Strings(minLen int) []FoundString {
+	if minLen < 1 {
+		minLen = 1
+	}
+	found := make([]FoundString, 0)
+	for _, r := range p.MemoryRanges() {
+		data := p.storage.ReadMemory(r.Start, r.End-r.Start)
+		found = append(found, asciiStrings(r.Start, data, minLen)...)
+		found = append(found, utf16Strings(r.Start, data, minLen)...)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Address < found[j].Address })
+	return found
+}
+
+// buildXrefs indexes the addresses referenced by every instruction.
+func (p *Project) buildXrefs() {
+	p.xrefs = make(map[uint64][]uint64)
+	p.scanCode(func(instr *Instruction) bool {
+		for _, ref := range instr.refs {
+			p.xrefs[ref] = append(p.xrefs[ref], instr.Address)
+		}
+		return true
+	})
+}
+
+// References returns the addresses of instructions that refer to addr by an
+// immediate or a memory operand.
+func (p *Project) References(addr uint64) []uint64 {
+	if p.xrefs == nil {
+		p.buildXrefs()
+	}
+	return p.xrefs[addr]
+}
+
+// WriteString overwrites a string in place. The new text must fit in the
+// space of the old one, and the rest is filled with NULs.
+func (p *Project) WriteString(s FoundString, text string) error {
+	var encoded []byte
+	switch s.Encoding {
+	case ASCIIString:
+		encoded = []byte(text)
+	case UTF16String:
+		for _, c := range utf16.Encode([]rune(text)) {
+			encoded = append(encoded, byte(c), byte(c>>8))
+		}
+	}
+	if uint64(len(encoded)) > s.Size {
+		return fmt.Errorf("too long: %d bytes, but only %d bytes fit", len(encoded), s.Size)
+	}
+	for uint64(len(encoded)) < s.Size {
+		encoded = append(encoded, 0)
+	}
+	p.WriteMemory(s.Address, encoded)
+	return nil
+}
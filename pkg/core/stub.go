@@ -0,0 +1,136 @@
+package binch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func sortedAddrs(set map[uint64]bool) []uint64 {
+	addrs := make([]uint64, 0, len(set))
+	for addr := range set {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// IsCode returns true if addr is in a code section.
+func (p *Project) IsCode(addr uint64) bool {
+	idx := p.findSectionIdx(addr)
+	if idx < 0 {
+		return false
+	}
+	section := p.storage.CodeRegions()[idx]
+	return addr >= section.Addr && addr < section.Addr+section.Size
+}
+
+// FunctionName returns the symbol of a function, or a generated name for
+// functions found by analysis.
+func (p *Project) FunctionName(addr uint64) string {
+	if name, exists := p.symbolName(addr); exists {
+		return name
+	}
+	return fmt.Sprintf("sub_%x", addr)
+}
+
+func (p *Project) isFunctionStart(addr uint64) bool {
+	p.analyzeRange(addr, addr+1)
+	idx := sort.Search(len(p.funcStarts), func(i int) bool {
+		return p.funcStarts[i] >= addr
+	})
+	return idx < len(p.funcStarts) && p.funcStarts[idx] == addr
+}
+
+// labelOf returns the label of addr in the listing.
+func (p *Project) labelOf(addr uint64) string {
+	if name, exists := p.symbolName(addr); exists {
+		return name
+	}
+	if p.isFunctionStart(addr) {
+		return p.FunctionName(addr)
+	}
+	return ""
+}
+
+// FindFunction returns the name and the start address of the function that
+// contains addr. Functions are known from symbols, exception tables and call
+// targets.
+func (p *Project) FindFunction(addr uint64) (string, uint64, bool) {
+	p.analyzeRange(addr, addr+1)
+	idx := sort.Search(len(p.funcStarts), func(i int) bool {
+		return p.funcStarts[i] > addr
+	}) - 1
+	for ; idx >= 0; idx-- {
+		start := p.funcStarts[idx]
+		if p.IsCode(start) && p.findSectionIdx(start) == p.findSectionIdx(addr) {
+			return p.FunctionName(start), start, true
+		}
+	}
+	return "", 0, false
+}
+
+func (p *Project) nopBytes() []byte {
+	if p.storage.Arch() == "EM_AARCH64" {
+		return []byte{0x1f, 0x20, 0x03, 0xd5}
+	}
+	return []byte{0x90}
+}
+
+func aarch64MoveImm(reg string, val uint64) []string {
+	lines := []string{fmt.Sprintf("movz %s, #0x%x", reg, val&0xffff)}
+	for shift := uint(16); shift < 64; shift += 16 {
+		if chunk := (val >> shift) & 0xffff; chunk != 0 {
+			lines = append(lines, fmt.Sprintf("movk %s, #0x%x, lsl #%d", reg, chunk, shift))
+		}
+	}
+	return lines
+}
+
+// ReturnStubAsm returns the assembly of a stub that immediately returns val
+// to the caller, following the calling convention of the binary.
+func (p *Project) ReturnStubAsm(val int64) []string {
+	switch p.storage.Arch() {
+	case "EM_X86_64":
+		switch {
+		case val >= 0 && val <= 0xffffffff:
+			// Writing eax zero-extends into rax, and it is shorter.
+			return []string{fmt.Sprintf("mov eax, 0x%x", val), "ret"}
+		case val < 0 && val >= -0x80000000:
+			// The immediate is sign-extended from 32 bits.
+			return []string{fmt.Sprintf("mov rax, %d", val), "ret"}
+		default:
+			return []string{fmt.Sprintf("movabs rax, %d", val), "ret"}
+		}
+	case "EM_386":
+		return []string{fmt.Sprintf("mov eax, 0x%x", uint32(val)), "ret"}
+	case "EM_AARCH64":
+		return append(aarch64MoveImm("x0", uint64(val)), "ret")
+	}
+	return nil
+}
+
+// ReturnPatch builds the bytes that make the function at addr return val. If
+// pad is true, the rest of the last overwritten instruction is filled with
+// nops so that the following instructions stay aligned.
+func (p *Project) ReturnPatch(addr uint64, val int64, pad bool) []byte {
+	asm := p.ReturnStubAsm(val)
+	if asm == nil {
+		return nil
+	}
+	stub := p.Assemble(strings.Join(asm, "; "), addr)
+	if stub == nil || !pad {
+		return stub
+	}
+
+	covered := 0
+	for instr := p.GetInstruction(addr); instr != nil && covered < len(stub); {
+		covered += len(instr.Bytes)
+		instr = p.FindNextInstruction(instr.Address)
+	}
+	nop := p.nopBytes()
+	for len(stub) < covered {
+		stub = append(stub, nop...)
+	}
+	return stub
+}
@@ -0,0 +1,167 @@
+package binch
+
+import (
+	"github.com/bnagy/gapstone"
+	"github.com/tunz/binch-go/pkg/io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SymbolEntry is a symbol of the binary, or a function found by analysis.
+type SymbolEntry struct {
+	bcio.Symbol
+	Detected bool
+}
+
+// SymbolEntries returns every symbol and detected function sorted by address.
+// Detected functions have no size, so it is estimated by the next function.
+func (p *Project) SymbolEntries() []SymbolEntry {
+	// The list shows every function, so every code section is analyzed.
+	p.analyzeRange(0, math.MaxUint64)
+	return p.symbolEntries()
+}
+
+// symbolEntries returns the symbols and the functions that are detected in
+// the code sections analyzed so far.
+func (p *Project) symbolEntries() []SymbolEntry {
+	entries := make([]SymbolEntry, 0, len(p.storage.SymbolList())+len(p.funcStarts))
+	for _, symbol := range p.storage.SymbolList() {
+		if label, exists := p.labels[symbol.Addr]; exists {
+			symbol.Name = label
+		} else {
+			symbol.Name = p.DisplayName(symbol.Name)
+		}
+		entries = append(entries, SymbolEntry{Symbol: symbol})
+	}
+	for i, addr := range p.funcStarts {
+		if _, exists := p.storage.SymbolAt(addr); exists {
+			continue
+		}
+		end := p.codeEnd(addr)
+		if i+1 < len(p.funcStarts) && p.funcStarts[i+1] < end {
+			end = p.funcStarts[i+1]
+		}
+		entries = append(entries, SymbolEntry{
+			Symbol: bcio.Symbol{
+				Name: p.FunctionName(addr),
+				Addr: addr,
+				Size: end - addr,
+				Kind: bcio.FuncSymbol,
+			},
+			Detected: true,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Addr < entries[j].Addr })
+	return entries
+}
+
+// importComment names the import that a call or a jump goes to through PLT
+// or GOT, e.g. "call qword ptr [rip + 0x2fe2]".
+func (p *Project) importComment(ins *gapstone.Instruction) string {
+	flow := flowOf(ins)
+	if !(flow.isCall || flow.isJump) {
+		return ""
+	}
+	if flow.hasTarget {
+		return p.DisplayName(p.imports[flow.target])
+	}
+	for _, ref := range refsOf(ins) {
+		if name, exists := p.imports[ref]; exists {
+			return p.DisplayName(name)
+		}
+	}
+	return ""
+}
+
+// demangle returns the demangled name, which is cached since labels are
+// looked up on every disassembly.
+func (p *Project) demangle(name string) string {
+	if demangled, exists := p.demangled[name]; exists {
+		return demangled
+	}
+	demangled := Demangle(name)
+	p.demangled[name] = demangled
+	return demangled
+}
+
+// DisplayName returns name as it is shown in the listing.
+func (p *Project) DisplayName(name string) string {
+	if p.rawNames {
+		return name
+	}
+	return p.demangle(name)
+}
+
+// symbolName returns the user label or the symbol of addr.
+func (p *Project) symbolName(addr uint64) (string, bool) {
+	if label, exists := p.labels[addr]; exists {
+		return label, true
+	}
+	if name, exists := p.storage.SymbolAt(addr); exists {
+		return p.DisplayName(name), true
+	}
+	return "", false
+}
+
+// RawNames returns true if symbols are shown without demangling.
+func (p *Project) RawNames() bool {
+	return p.rawNames
+}
+
+// SetRawNames switches between raw and demangled symbol names. Labels and
+// comments are made with the disassembly, so the code caches are dropped.
+func (p *Project) SetRawNames(raw bool) {
+	p.rawNames = raw
+	p.invalidateAll()
+}
+
+// LookupName returns the address of a user label, of a symbol by its raw or
+// demangled name, or of a detected function by its generated name.
+func (p *Project) LookupName(name string) (uint64, bool) {
+	for addr, label := range p.labels {
+		if label == name {
+			return addr, true
+		}
+	}
+	if addr, exists := p.storage.LookupSymbol(name); exists {
+		return addr, true
+	}
+	for _, symbol := range p.storage.SymbolList() {
+		if p.demangle(symbol.Name) == name {
+			return symbol.Addr, true
+		}
+	}
+	if strings.HasPrefix(name, "sub_") {
+		addr, err := strconv.ParseUint(name[len("sub_"):], 16, 64)
+		if err == nil && p.isFunctionStart(addr) {
+			return addr, true
+		}
+	}
+	return 0, false
+}
+
+// CompleteName returns the sorted names of symbols, functions and user labels
+// that start with prefix. Only functions of analyzed code sections are
+// completed, so that completing does not analyze the whole program.
+func (p *Project) CompleteName(prefix string) []string {
+	candidates := make([]string, 0, len(p.storage.SymbolList())+len(p.labels))
+	for _, entry := range p.symbolEntries() {
+		candidates = append(candidates, entry.Name)
+	}
+	for _, label := range p.labels {
+		candidates = append(candidates, label)
+	}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, name := range candidates {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
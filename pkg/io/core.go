@@ -0,0 +1,364 @@
+package bcio
+
+import (
+	"debug/elf"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Note types of Linux core files.
+const (
+	ntPrstatus = 1
+	ntSiginfo  = 0x53494749
+	ntFile     = 0x46494c45
+)
+
+// Register is a register of a thread in a core file.
+type Register struct {
+	Name  string
+	Value uint64
+}
+
+// Thread is the state of a thread in a core file.
+type Thread struct {
+	Pid    int
+	Signal int // Signal that the thread got, or 0.
+	PC     uint64
+	Regs   []Register
+}
+
+// MappedFile is a file mapping of the process of a core file.
+type MappedFile struct {
+	Path   string
+	Start  uint64
+	End    uint64
+	Offset uint64 // Offset in the file.
+	// Loaded means that the file is found, so its symbols and code are shown
+	// and memory that the core file lacks is read from it.
+	Loaded bool
+}
+
+// CoreInfo is what a core file records about the crashed process.
+type CoreInfo struct {
+	Threads   []Thread // The faulting thread comes first.
+	FaultAddr uint64   // Faulting address of SIGSEGV, SIGBUS, SIGILL or SIGFPE.
+	Files     []MappedFile
+}
+
+// prstatusLayout is where struct elf_prstatus keeps the pid, the current
+// signal and the registers.
+type prstatusLayout struct {
+	pidOff  int
+	regOff  int
+	regSize int
+	regs    []string
+	pc      string
+}
+
+var prstatusLayouts = map[elf.Machine]prstatusLayout{
+	elf.EM_X86_64: {32, 112, 8, []string{
+		"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8",
+		"rax", "rcx", "rdx", "rsi", "rdi", "orig_rax", "rip", "cs", "eflags",
+		"rsp", "ss", "fs_base", "gs_base", "ds", "es", "fs", "gs",
+	}, "rip"},
+	elf.EM_386: {24, 72, 4, []string{
+		"ebx", "ecx", "edx", "esi", "edi", "ebp", "eax", "ds", "es", "fs", "gs",
+		"orig_eax", "eip", "cs", "eflags", "esp", "ss",
+	}, "eip"},
+	elf.EM_AARCH64: {32, 112, 8, []string{
+		"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10",
+		"x11", "x12", "x13", "x14", "x15", "x16", "x17", "x18", "x19", "x20",
+		"x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29", "x30",
+		"sp", "pc", "pstate",
+	}, "pc"},
+}
+
+type coreNote struct {
+	typ  uint32
+	desc []byte
+}
+
+// readNotes reads the notes of the PT_NOTE segments.
+func readNotes(_elf *elf.File) []coreNote {
+	notes := make([]coreNote, 0)
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for _, prog := range _elf.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			continue
+		}
+		for off := uint32(0); off+12 <= uint32(len(data)); {
+			namesz := _elf.ByteOrder.Uint32(data[off:])
+			descsz := _elf.ByteOrder.Uint32(data[off+4:])
+			typ := _elf.ByteOrder.Uint32(data[off+8:])
+			start := off + 12 + align(namesz)
+			if start+descsz > uint32(len(data)) {
+				break
+			}
+			notes = append(notes, coreNote{typ, data[start : start+descsz]})
+			off = start + align(descsz)
+		}
+	}
+	return notes
+}
+
+func (t headerTables) word(data []byte, idx int) uint64 {
+	size := 4
+	if t.class == elf.ELFCLASS64 {
+		size = 8
+	}
+	if (idx+1)*size > len(data) {
+		return 0
+	}
+	return t.decode(data[idx*size : (idx+1)*size])
+}
+
+func parseThread(t headerTables, machine elf.Machine, desc []byte) (Thread, bool) {
+	layout, ok := prstatusLayouts[machine]
+	if !ok || len(desc) < layout.regOff+len(layout.regs)*layout.regSize {
+		return Thread{}, false
+	}
+	thread := Thread{
+		Pid:    int(t.decode(desc[layout.pidOff : layout.pidOff+4])),
+		Signal: int(t.decode(desc[12:14])), // pr_cursig
+		Regs:   make([]Register, len(layout.regs)),
+	}
+	for i, name := range layout.regs {
+		off := layout.regOff + i*layout.regSize
+		thread.Regs[i] = Register{name, t.decode(desc[off : off+layout.regSize])}
+		if name == layout.pc {
+			thread.PC = thread.Regs[i].Value
+		}
+	}
+	return thread, true
+}
+
+// parseFaultAddr returns si_addr of a signal that faults on an address.
+func parseFaultAddr(t headerTables, desc []byte) uint64 {
+	if len(desc) < 4 {
+		return 0
+	}
+	switch t.decode(desc[0:4]) {
+	case 4, 7, 8, 11: // SIGILL, SIGBUS, SIGFPE, SIGSEGV
+	default:
+		return 0
+	}
+	// The union of siginfo_t is aligned to pointers.
+	if t.class == elf.ELFCLASS64 {
+		return t.word(desc, 2)
+	}
+	return t.word(desc, 3)
+}
+
+// parseFiles parses NT_FILE: the number of mappings, the page size, the
+// start, end and page offset of every mapping, and then their paths.
+func parseFiles(t headerTables, desc []byte) []MappedFile {
+	size := 4
+	if t.class == elf.ELFCLASS64 {
+		size = 8
+	}
+	// The count comes from the file, so it is checked against the size of
+	// the note before any arithmetic.
+	rawCount := t.word(desc, 0)
+	if len(desc)/size < 2 || rawCount > uint64((len(desc)/size-2)/3) {
+		return nil
+	}
+	count := int(rawCount)
+	page := t.word(desc, 1)
+	names := (2 + count*3) * size
+	files := make([]MappedFile, 0, count)
+	pos := names
+	for i := 0; i < count && pos < len(desc); i++ {
+		end := pos
+		for end < len(desc) && desc[end] != 0 {
+			end++
+		}
+		files = append(files, MappedFile{
+			Path:   string(desc[pos:end]),
+			Start:  t.word(desc, 2+i*3),
+			End:    t.word(desc, 3+i*3),
+			Offset: t.word(desc, 4+i*3) * page,
+		})
+		pos = end + 1
+	}
+	return files
+}
+
+// mappedImage is a file that a core file maps, loaded at bias.
+type mappedImage struct {
+	path string
+	elf  *elf.File
+	file *os.File
+	bias uint64
+}
+
+// openImage opens a mapped file, and finds its load bias from the mapping of
+// its first PT_LOAD segment.
+func openImage(path string, sysroot string, files []MappedFile) (*mappedImage, error) {
+	f, err := os.Open(filepath.Join(sysroot, path))
+	if err != nil {
+		return nil, err
+	}
+	_elf, err := elf.NewFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, prog := range _elf.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		for _, m := range files {
+			if m.Path == path && m.Offset == prog.Off&^(pageSize-1) {
+				return &mappedImage{path, _elf, f, m.Start - prog.Vaddr&^(pageSize-1)}, nil
+			}
+		}
+		break
+	}
+	f.Close()
+	return nil, fmt.Errorf("%s: the first segment is not mapped", path)
+}
+
+// addImageMemory reads the parts of a mapping that the core file lacks, e.g.
+// code that is dumped only as its first page.
+func addImageMemory(memory []memSegment, image *mappedImage, m MappedFile) []memSegment {
+	covered := uint64(0)
+	for _, seg := range memory {
+		if seg.Vaddr == m.Start && uint64(len(seg.Data)) > covered {
+			covered = uint64(len(seg.Data))
+		}
+	}
+	if covered >= m.End-m.Start {
+		return memory
+	}
+	buf, err := mapFile(image.file, int64(m.Offset+covered), m.End-m.Start-covered)
+	if err != nil || len(buf) == 0 {
+		return memory
+	}
+	return append(memory, memSegment{
+		Vaddr:   m.Start + covered,
+		Offset:  int64(m.Offset + covered),
+		Memsz:   m.End - m.Start - covered,
+		Data:    buf,
+		changes: make(map[int]byte),
+		source:  image.path,
+	})
+}
+
+// ReadCore loads a core file with the files that it maps, which are looked up
+// under sysroot if it is not empty.
+func ReadCore(filename string, sysroot string) *Binary {
+	f, err := os.Open(filename)
+	if err != nil {
+		panic("No such file")
+	}
+	defer f.Close()
+
+	_elf, err := elf.NewFile(f)
+	if err != nil || _elf.Type != elf.ET_CORE {
+		panic("Failed to load the core file")
+	}
+	return readCore(filename, f, _elf, sysroot)
+}
+
+func readCore(filename string, f *os.File, _elf *elf.File, sysroot string) *Binary {
+	memory := loadCodeSegments(f, _elf)
+	tables, headers := loadHeaders(f, _elf)
+
+	core := &CoreInfo{}
+	for _, note := range readNotes(_elf) {
+		switch note.typ {
+		case ntPrstatus:
+			if thread, ok := parseThread(tables, _elf.Machine, note.desc); ok {
+				core.Threads = append(core.Threads, thread)
+			}
+		case ntSiginfo:
+			if core.FaultAddr == 0 {
+				core.FaultAddr = parseFaultAddr(tables, note.desc)
+			}
+		case ntFile:
+			core.Files = parseFiles(tables, note.desc)
+		}
+	}
+
+	b := &Binary{
+		filename:    filename,
+		memory:      memory,
+		headers:     headers,
+		tables:      tables,
+		Symbol2Addr: make(map[string]uint64),
+		Addr2Symbol: make(map[uint64]string),
+		Symbols:     make([]Symbol, 0),
+		Sections:    loadSections(_elf),
+		ProgHeaders: loadProgHeaders(_elf),
+		MachineType: _elf.Machine.String(),
+		Core:        core,
+	}
+	// The first mapping is usually the executable, so its names win.
+	images := make(map[string]*mappedImage)
+	for i, m := range core.Files {
+		image, opened := images[m.Path]
+		if !opened {
+			var err error
+			image, err = openImage(m.Path, sysroot, core.Files)
+			if err != nil {
+				log.Printf("Failed to load %s: %v", m.Path, err)
+			} else {
+				defer image.file.Close()
+				b.addImage(image)
+			}
+			images[m.Path] = image
+		}
+		if image != nil {
+			core.Files[i].Loaded = true
+			b.memory = addImageMemory(b.memory, image, m)
+		}
+	}
+	sortCodeSections(b.CodeSections)
+
+	// The listing starts at the faulting instruction if its code is loaded.
+	if len(b.CodeSections) > 0 {
+		b.Entry = b.CodeSections[0].Addr
+	}
+	if len(core.Threads) > 0 {
+		pc := core.Threads[0].PC
+		for _, section := range b.CodeSections {
+			if pc >= section.Addr && pc < section.Addr+section.Size {
+				b.Entry = pc
+			}
+		}
+	}
+	return b
+}
+
+// addImage adds the symbols, code sections and functions of a mapped file at
+// their runtime addresses.
+func (b *Binary) addImage(image *mappedImage) {
+	_, _, symbols := loadSymbols(image.elf)
+	dynSymbols, _ := loadDynamicSymbols(image.elf)
+	for _, list := range [][]Symbol{symbols, dynSymbols} {
+		// Undefined symbols have no address.
+		shifted := make([]Symbol, 0, len(list))
+		for _, symbol := range list {
+			if symbol.Addr != 0 {
+				symbol.Addr += image.bias
+				shifted = append(shifted, symbol)
+			}
+		}
+		b.Symbols = mergeSymbols(b.Symbol2Addr, b.Addr2Symbol, b.Symbols, shifted)
+	}
+	for _, section := range findCodeSection(image.elf) {
+		if section.Addr != 0 {
+			section.Addr += image.bias
+			b.CodeSections = append(b.CodeSections, section)
+		}
+	}
+	for _, addr := range loadEHFunctions(image.elf) {
+		b.EHFunctions = append(b.EHFunctions, addr+image.bias)
+	}
+}
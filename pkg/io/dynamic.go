@@ -0,0 +1,536 @@
+package bcio
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// spareDynEntries is the number of DT_NULL entries that are added when the
+// dynamic section is moved, so that later entries fit in place.
+const spareDynEntries = 4
+
+// DynEntry is an entry of the dynamic section.
+type DynEntry struct {
+	Tag   elf.DynTag
+	Value uint64
+	// Str is the string of DT_NEEDED, DT_SONAME, DT_RPATH and DT_RUNPATH.
+	Str string
+}
+
+func hasString(tag elf.DynTag) bool {
+	switch tag {
+	case elf.DT_NEEDED, elf.DT_SONAME, elf.DT_RPATH, elf.DT_RUNPATH:
+		return true
+	}
+	return false
+}
+
+// refersToString returns true if the value of tag is an offset in the
+// dynamic string table. It covers more tags than hasString, for checking
+// whether a string is shared.
+func refersToString(tag elf.DynTag) bool {
+	switch tag {
+	case elf.DT_AUXILIARY, elf.DT_FILTER, elf.DT_CONFIG, elf.DT_DEPAUDIT, elf.DT_AUDIT:
+		return true
+	}
+	return hasString(tag)
+}
+
+func (b *Binary) dynEntrySize() int {
+	if b.tables.class == elf.ELFCLASS64 {
+		return 16
+	}
+	return 8
+}
+
+func (b *Binary) dynamicHeader() (int, error) {
+	found := b.findProgHeaders(elf.PT_DYNAMIC)
+	if len(found) == 0 {
+		return -1, fmt.Errorf("no dynamic section")
+	}
+	return found[0], nil
+}
+
+// readDynamic returns every entry of the dynamic section including the
+// trailing DT_NULL entries.
+func (b *Binary) readDynamic() ([]DynEntry, error) {
+	phdrIdx, err := b.dynamicHeader()
+	if err != nil {
+		return nil, err
+	}
+	offset := int64(b.headerValue(ProgramHeader, phdrIdx, "p_offset"))
+	size := int(b.headerValue(ProgramHeader, phdrIdx, "p_filesz"))
+	data := b.ReadFile(offset, size)
+	if data == nil {
+		return nil, fmt.Errorf("dynamic section is not loaded")
+	}
+
+	entSize := b.dynEntrySize()
+	half := entSize / 2
+	entries := make([]DynEntry, 0, size/entSize)
+	for off := 0; off+entSize <= len(data); off += entSize {
+		entries = append(entries, DynEntry{
+			Tag:   elf.DynTag(b.tables.decode(data[off : off+half])),
+			Value: b.tables.decode(data[off+half : off+entSize]),
+		})
+	}
+	return entries, nil
+}
+
+// writeDynamic writes entries over the dynamic section, or moves it to new
+// memory if they do not fit.
+func (b *Binary) writeDynamic(entries []DynEntry) error {
+	phdrIdx, err := b.dynamicHeader()
+	if err != nil {
+		return err
+	}
+	entSize := b.dynEntrySize()
+	data := make([]byte, 0, len(entries)*entSize)
+	for _, e := range entries {
+		data = append(data, b.tables.encode(uint64(e.Tag), entSize/2)...)
+		data = append(data, b.tables.encode(e.Value, entSize/2)...)
+	}
+
+	addr := b.headerValue(ProgramHeader, phdrIdx, "p_vaddr")
+	if uint64(len(data)) > b.headerValue(ProgramHeader, phdrIdx, "p_filesz") {
+		for i := 0; i < spareDynEntries; i++ {
+			data = append(data, make([]byte, entSize)...)
+		}
+		// The loader writes to the dynamic section, e.g. DT_DEBUG.
+		newAddr, err := b.Allocate(uint64(len(data)), uint64(entSize), elf.PF_R|elf.PF_W)
+		if err != nil {
+			return err
+		}
+		b.moveSection(elf.SHT_DYNAMIC, addr, newAddr, uint64(len(data)))
+		offset, _ := b.offsetOf(newAddr)
+		for name, value := range map[string]uint64{
+			"p_offset": uint64(offset),
+			"p_vaddr":  newAddr,
+			"p_paddr":  newAddr,
+			"p_filesz": uint64(len(data)),
+			"p_memsz":  uint64(len(data)),
+		} {
+			b.setHeaderValue(ProgramHeader, phdrIdx, name, value)
+		}
+		addr = newAddr
+	}
+	b.WriteMemory(addr, data)
+	// The tables may have moved, or the dynamic section with them.
+	b.invalidateRelocs()
+	return nil
+}
+
+// moveSection points the section header of a moved section at its new place.
+func (b *Binary) moveSection(typ elf.SectionType, oldAddr uint64, newAddr uint64, size uint64) {
+	idx := b.findSectionAt(typ, oldAddr)
+	if idx < 0 {
+		return
+	}
+	offset, _ := b.offsetOf(newAddr)
+	b.setHeaderValue(SectionHeader, idx, "sh_addr", newAddr)
+	b.setHeaderValue(SectionHeader, idx, "sh_offset", uint64(offset))
+	b.setHeaderValue(SectionHeader, idx, "sh_size", size)
+}
+
+func dynValue(entries []DynEntry, tag elf.DynTag) (uint64, bool) {
+	for _, e := range entries {
+		if e.Tag == tag {
+			return e.Value, true
+		}
+	}
+	return 0, false
+}
+
+// dynStrings returns the dynamic string table and its address.
+func (b *Binary) dynStrings(entries []DynEntry) ([]byte, uint64, error) {
+	addr, hasAddr := dynValue(entries, elf.DT_STRTAB)
+	size, hasSize := dynValue(entries, elf.DT_STRSZ)
+	if !hasAddr || !hasSize {
+		return nil, 0, fmt.Errorf("no dynamic string table")
+	}
+	data := b.ReadMemory(addr, size)
+	if uint64(len(data)) != size {
+		return nil, 0, fmt.Errorf("dynamic string table is not loaded")
+	}
+	return data, addr, nil
+}
+
+func cString(data []byte, off uint64) string {
+	if off >= uint64(len(data)) {
+		return ""
+	}
+	s := data[off:]
+	if end := bytes.IndexByte(s, 0); end >= 0 {
+		s = s[:end]
+	}
+	return string(s)
+}
+
+// DynamicEntries returns the entries of the dynamic section up to DT_NULL.
+func (b *Binary) DynamicEntries() ([]DynEntry, error) {
+	entries, err := b.readDynamic()
+	if err != nil {
+		return nil, err
+	}
+	strtab, _, err := b.dynStrings(entries)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]DynEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Tag == elf.DT_NULL {
+			break
+		}
+		if hasString(e.Tag) {
+			e.Str = cString(strtab, e.Value)
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// maxVersionEntries bounds the walk of the version tables, whose counts and
+// links come from the file.
+const maxVersionEntries = 1 << 16
+
+// dynStringRefs returns the offsets in the dynamic string table that are
+// used by the dynamic entries other than entries[skip], by the dynamic
+// symbols, and by the symbol versions. Strings share their tails, so a string
+// is overwritten only if none of these falls in it. It fails if a table
+// cannot be read, since shared strings cannot be ruled out then.
+func (b *Binary) dynStringRefs(entries []DynEntry, skip int) ([]uint64, error) {
+	errUnknown := fmt.Errorf("cannot find the users of the dynamic string table")
+	read := func(addr uint64, size uint64) (uint64, bool) {
+		data := b.ReadMemory(addr, size)
+		return b.tables.decode(data), uint64(len(data)) == size
+	}
+
+	refs := make([]uint64, 0)
+	for i, e := range entries {
+		if i != skip && refersToString(e.Tag) {
+			refs = append(refs, e.Value)
+		}
+	}
+
+	if symtab, ok := dynValue(entries, elf.DT_SYMTAB); ok {
+		idx := b.findSectionAt(elf.SHT_DYNSYM, symtab)
+		if idx < 0 {
+			return nil, errUnknown
+		}
+		size := b.headerValue(SectionHeader, idx, "sh_size")
+		entSize := b.headerValue(SectionHeader, idx, "sh_entsize")
+		if entSize == 0 {
+			return nil, errUnknown
+		}
+		// st_name is the first field of Elf32_Sym and Elf64_Sym.
+		for off := uint64(0); off+entSize <= size; off += entSize {
+			name, ok := read(symtab+off, 4)
+			if !ok {
+				return nil, errUnknown
+			}
+			refs = append(refs, name)
+		}
+	}
+
+	// Elf_Verdef and Elf_Verdaux: vd_cnt, vd_aux and vd_next, and vda_name
+	// and vda_next.
+	addr, _ := dynValue(entries, elf.DT_VERDEF)
+	num, _ := dynValue(entries, elf.DT_VERDEFNUM)
+	for i := uint64(0); i < num && i < maxVersionEntries; i++ {
+		cnt, ok1 := read(addr+6, 2)
+		aux, ok2 := read(addr+12, 4)
+		next, ok3 := read(addr+16, 4)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, errUnknown
+		}
+		for j, a := uint64(0), addr+aux; j < cnt && j < maxVersionEntries; j++ {
+			name, ok1 := read(a, 4)
+			anext, ok2 := read(a+4, 4)
+			if !ok1 || !ok2 {
+				return nil, errUnknown
+			}
+			refs = append(refs, name)
+			a += anext
+		}
+		if next == 0 {
+			break
+		}
+		addr += next
+	}
+
+	// Elf_Verneed and Elf_Vernaux: vn_cnt, vn_file, vn_aux and vn_next, and
+	// vna_name and vna_next.
+	addr, _ = dynValue(entries, elf.DT_VERNEED)
+	num, _ = dynValue(entries, elf.DT_VERNEEDNUM)
+	for i := uint64(0); i < num && i < maxVersionEntries; i++ {
+		cnt, ok1 := read(addr+2, 2)
+		file, ok2 := read(addr+4, 4)
+		aux, ok3 := read(addr+8, 4)
+		next, ok4 := read(addr+12, 4)
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, errUnknown
+		}
+		refs = append(refs, file)
+		for j, a := uint64(0), addr+aux; j < cnt && j < maxVersionEntries; j++ {
+			name, ok1 := read(a+8, 4)
+			anext, ok2 := read(a+12, 4)
+			if !ok1 || !ok2 {
+				return nil, errUnknown
+			}
+			refs = append(refs, name)
+			a += anext
+		}
+		if next == 0 {
+			break
+		}
+		addr += next
+	}
+	return refs, nil
+}
+
+// isSharedString returns true if another user of the dynamic string table
+// refers to bytes of the string at off, e.g. to its tail.
+func (b *Binary) isSharedString(entries []DynEntry, skip int, strtab []byte, off uint64) bool {
+	refs, err := b.dynStringRefs(entries, skip)
+	if err != nil {
+		return true
+	}
+	end := off + uint64(len(cString(strtab, off)))
+	for _, ref := range refs {
+		if ref <= end && ref+uint64(len(cString(strtab, ref))) >= off {
+			return true
+		}
+	}
+	return false
+}
+
+// addDynString returns the offset of s in the dynamic string table. A new
+// string is appended to a copy of the table in new memory, or to the copy
+// itself if it ends the new memory.
+func (b *Binary) addDynString(entries []DynEntry, s string) (uint64, error) {
+	strtab, oldAddr, err := b.dynStrings(entries)
+	if err != nil {
+		return 0, err
+	}
+	// Strings may share their tails, e.g. "libc.so.6" and "c.so.6".
+	if idx := bytes.Index(strtab, append([]byte(s), 0)); idx >= 0 {
+		return uint64(idx), nil
+	}
+
+	if b.endsExtension(oldAddr, uint64(len(strtab)), elf.PF_R) {
+		added := append([]byte(s), 0)
+		addr, err := b.Allocate(uint64(len(added)), 1, elf.PF_R)
+		if err != nil {
+			return 0, err
+		}
+		if addr == oldAddr+uint64(len(strtab)) {
+			b.WriteMemory(addr, added)
+			newSize := uint64(len(strtab) + len(added))
+			b.moveSection(elf.SHT_STRTAB, oldAddr, oldAddr, newSize)
+			for i := range entries {
+				if entries[i].Tag == elf.DT_STRSZ {
+					entries[i].Value = newSize
+				}
+			}
+			return uint64(len(strtab)), nil
+		}
+	}
+
+	newTab := append(append(append([]byte{}, strtab...), s...), 0)
+	newAddr, err := b.Allocate(uint64(len(newTab)), 1, elf.PF_R)
+	if err != nil {
+		return 0, err
+	}
+	b.WriteMemory(newAddr, newTab)
+	b.moveSection(elf.SHT_STRTAB, oldAddr, newAddr, uint64(len(newTab)))
+	for i := range entries {
+		switch entries[i].Tag {
+		case elf.DT_STRTAB:
+			entries[i].Value = newAddr
+		case elf.DT_STRSZ:
+			entries[i].Value = uint64(len(newTab))
+		}
+	}
+	return uint64(len(strtab)), nil
+}
+
+// insertDynEntry adds an entry before the first DT_NULL. New DT_NEEDED
+// entries go after the last one, since the order is the search order.
+func insertDynEntry(entries []DynEntry, e DynEntry) []DynEntry {
+	pos := len(entries)
+	for i, old := range entries {
+		if old.Tag == elf.DT_NULL {
+			pos = i
+			break
+		}
+	}
+	if e.Tag == elf.DT_NEEDED {
+		for i := pos - 1; i >= 0; i-- {
+			if entries[i].Tag == elf.DT_NEEDED {
+				pos = i + 1
+				break
+			}
+		}
+	}
+	entries = append(entries, DynEntry{})
+	copy(entries[pos+1:], entries[pos:])
+	entries[pos] = e
+	// Keep the terminator if the entry took the last DT_NULL.
+	if entries[len(entries)-1].Tag != elf.DT_NULL {
+		entries = append(entries, DynEntry{Tag: elf.DT_NULL})
+	}
+	return trimDynNulls(entries)
+}
+
+// trimDynNulls drops a trailing DT_NULL that was pushed out of the section
+// by an insertion, while keeping the others as spare entries.
+func trimDynNulls(entries []DynEntry) []DynEntry {
+	n := len(entries)
+	if n > 1 && entries[n-1].Tag == elf.DT_NULL && entries[n-2].Tag == elf.DT_NULL {
+		return entries[:n-1]
+	}
+	return entries
+}
+
+// AddNeeded adds a DT_NEEDED entry of lib.
+func (b *Binary) AddNeeded(lib string) error {
+	entries, err := b.readDynamic()
+	if err != nil {
+		return err
+	}
+	current, err := b.DynamicEntries()
+	if err != nil {
+		return err
+	}
+	for _, e := range current {
+		if e.Tag == elf.DT_NEEDED && e.Str == lib {
+			return fmt.Errorf("%s is already needed", lib)
+		}
+	}
+	off, err := b.addDynString(entries, lib)
+	if err != nil {
+		return err
+	}
+	return b.writeDynamic(insertDynEntry(entries, DynEntry{Tag: elf.DT_NEEDED, Value: off}))
+}
+
+// RemoveNeeded removes the DT_NEEDED entry of lib.
+func (b *Binary) RemoveNeeded(lib string) error {
+	entries, err := b.readDynamic()
+	if err != nil {
+		return err
+	}
+	current, err := b.DynamicEntries()
+	if err != nil {
+		return err
+	}
+	for i, e := range current {
+		if e.Tag == elf.DT_NEEDED && e.Str == lib {
+			entries = append(entries[:i], entries[i+1:]...)
+			return b.writeDynamic(append(entries, DynEntry{Tag: elf.DT_NULL}))
+		}
+	}
+	return fmt.Errorf("%s is not needed", lib)
+}
+
+// SetSearchPath sets DT_RPATH or DT_RUNPATH. An empty path removes it. A
+// path that fits in the old one is written in place.
+func (b *Binary) SetSearchPath(tag elf.DynTag, path string) error {
+	if tag != elf.DT_RPATH && tag != elf.DT_RUNPATH {
+		return fmt.Errorf("%v is not a search path", tag)
+	}
+	entries, err := b.readDynamic()
+	if err != nil {
+		return err
+	}
+	current, err := b.DynamicEntries()
+	if err != nil {
+		return err
+	}
+	idx := -1
+	for i, e := range current {
+		if e.Tag == tag {
+			idx = i
+		}
+	}
+
+	if path == "" {
+		if idx < 0 {
+			return nil
+		}
+		entries = append(entries[:idx], entries[idx+1:]...)
+		return b.writeDynamic(append(entries, DynEntry{Tag: elf.DT_NULL}))
+	}
+	strtab, strAddr, err := b.dynStrings(entries)
+	if err != nil {
+		return err
+	}
+	if idx >= 0 && len(path) <= len(current[idx].Str) && !b.isSharedString(entries, idx, strtab, entries[idx].Value) {
+		padded := make([]byte, len(current[idx].Str))
+		copy(padded, path)
+		b.WriteMemory(strAddr+current[idx].Value, padded)
+		return nil
+	}
+
+	off, err := b.addDynString(entries, path)
+	if err != nil {
+		return err
+	}
+	if idx >= 0 {
+		entries[idx].Value = off
+		return b.writeDynamic(entries)
+	}
+	return b.writeDynamic(insertDynEntry(entries, DynEntry{Tag: tag, Value: off}))
+}
+
+// Interpreter returns the path of the program interpreter in PT_INTERP.
+func (b *Binary) Interpreter() (string, error) {
+	found := b.findProgHeaders(elf.PT_INTERP)
+	if len(found) == 0 {
+		return "", fmt.Errorf("no program interpreter")
+	}
+	offset := int64(b.headerValue(ProgramHeader, found[0], "p_offset"))
+	data := b.ReadFile(offset, int(b.headerValue(ProgramHeader, found[0], "p_filesz")))
+	return cString(data, 0), nil
+}
+
+// SetInterpreter changes the program interpreter. A path that does not fit in
+// PT_INTERP is moved to new memory.
+func (b *Binary) SetInterpreter(path string) error {
+	found := b.findProgHeaders(elf.PT_INTERP)
+	if len(found) == 0 {
+		return fmt.Errorf("no program interpreter")
+	}
+	if path == "" || strings.IndexByte(path, 0) >= 0 {
+		return fmt.Errorf("invalid interpreter: %q", path)
+	}
+	phdrIdx := found[0]
+	size := b.headerValue(ProgramHeader, phdrIdx, "p_filesz")
+	if uint64(len(path)) < size {
+		padded := make([]byte, size)
+		copy(padded, path)
+		b.WriteFile(int64(b.headerValue(ProgramHeader, phdrIdx, "p_offset")), padded)
+		return nil
+	}
+
+	data := append([]byte(path), 0)
+	addr, err := b.Allocate(uint64(len(data)), 1, elf.PF_R)
+	if err != nil {
+		return err
+	}
+	b.WriteMemory(addr, data)
+	b.moveSection(elf.SHT_PROGBITS, b.headerValue(ProgramHeader, phdrIdx, "p_vaddr"), addr, uint64(len(data)))
+	offset, _ := b.offsetOf(addr)
+	for name, value := range map[string]uint64{
+		"p_offset": uint64(offset),
+		"p_vaddr":  addr,
+		"p_paddr":  addr,
+		"p_filesz": uint64(len(data)),
+		"p_memsz":  uint64(len(data)),
+	} {
+		b.setHeaderValue(ProgramHeader, phdrIdx, name, value)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package bcio
+
+import (
+	"debug/elf"
+	"encoding/binary"
+)
+
+// Pointer encodings of .eh_frame_hdr (DW_EH_PE_*).
+const (
+	ehPeAbsptr  = 0x00
+	ehPeUdata2  = 0x02
+	ehPeUdata4  = 0x03
+	ehPeUdata8  = 0x04
+	ehPeSdata2  = 0x0a
+	ehPeSdata4  = 0x0b
+	ehPeSdata8  = 0x0c
+	ehPePcrel   = 0x10
+	ehPeDatarel = 0x30
+	ehPeOmit    = 0xff
+)
+
+type ehReader struct {
+	data    []byte
+	pos     int
+	base    uint64
+	order   binary.ByteOrder
+	ptrSize int
+}
+
+// size returns the size of a pointer with the given encoding, or 0 if the
+// encoding is not supported.
+func (r *ehReader) size(enc byte) int {
+	switch enc & 0x0f {
+	case ehPeAbsptr:
+		return r.ptrSize
+	case ehPeUdata2, ehPeSdata2:
+		return 2
+	case ehPeUdata4, ehPeSdata4:
+		return 4
+	case ehPeUdata8, ehPeSdata8:
+		return 8
+	}
+	return 0
+}
+
+// read decodes a pointer with the given encoding. It returns false if the
+// encoding is not supported or the data is too short.
+func (r *ehReader) read(enc byte) (uint64, bool) {
+	pc := r.base + uint64(r.pos)
+	size := r.size(enc)
+	if size == 0 || size > len(r.data)-r.pos {
+		return 0, false
+	}
+
+	buf := r.data[r.pos : r.pos+size]
+	r.pos += size
+	var val uint64
+	switch {
+	case size == 2 && enc&0x0f == ehPeSdata2:
+		val = uint64(int16(r.order.Uint16(buf)))
+	case size == 2:
+		val = uint64(r.order.Uint16(buf))
+	case size == 4 && enc&0x0f == ehPeSdata4:
+		val = uint64(int32(r.order.Uint32(buf)))
+	case size == 4:
+		val = uint64(r.order.Uint32(buf))
+	default:
+		val = r.order.Uint64(buf)
+	}
+
+	switch enc & 0x70 {
+	case ehPePcrel:
+		val += pc
+	case ehPeDatarel:
+		val += r.base
+	}
+	return val, true
+}
+
+// loadEHFunctions reads function start addresses from the binary search
+// table of .eh_frame_hdr.
+func loadEHFunctions(_elf *elf.File) []uint64 {
+	section := _elf.Section(".eh_frame_hdr")
+	if section == nil {
+		return nil
+	}
+	data, err := section.Data()
+	if err != nil || len(data) < 4 || data[0] != 1 {
+		return nil
+	}
+
+	ptrSize := 8
+	if _elf.Class == elf.ELFCLASS32 {
+		ptrSize = 4
+	}
+	r := &ehReader{
+		data:    data,
+		pos:     4,
+		base:    section.Addr,
+		order:   _elf.ByteOrder,
+		ptrSize: ptrSize,
+	}
+	framePtrEnc, countEnc, tableEnc := data[1], data[2], data[3]
+	if framePtrEnc == ehPeOmit || countEnc == ehPeOmit || tableEnc == ehPeOmit {
+		return nil
+	}
+	if _, ok := r.read(framePtrEnc); !ok {
+		return nil
+	}
+	count, ok := r.read(countEnc)
+	if !ok {
+		return nil
+	}
+	// The count comes from the file, so it is checked against the table
+	// before it is used as a capacity.
+	entrySize := 2 * r.size(tableEnc)
+	if entrySize == 0 || count > uint64((len(data)-r.pos)/entrySize) {
+		return nil
+	}
+
+	functions := make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		initialLoc, ok := r.read(tableEnc)
+		if !ok {
+			break
+		}
+		if _, ok := r.read(tableEnc); !ok {
+			break
+		}
+		functions = append(functions, initialLoc)
+	}
+	return functions
+}
@@ -5,51 +5,180 @@ import (
 	"log"
 	"os"
 	"sort"
+	"strings"
 )
 
 type memSegment struct {
-	Vaddr   uint64
-	Offset  int64
-	Memsz   uint64
-	Data    []uint8
+	Vaddr  uint64
+	Offset int64
+	Memsz  uint64
+	Data   []uint8
+	// changes are the patched bytes of Data, which Save writes to the file.
 	changes map[int]byte
+	// source is the file that Data is read from if it is not the binary, e.g.
+	// a library that a core file maps. Such memory is read-only.
+	source string
+	// lazy reads Data when it is accessed, or is nil if Data is read.
+	lazy *lazyPages
 }
 
-type codeSection struct {
+// CodeRegion is a range of memory that is disassembled as code.
+type CodeRegion struct {
 	Addr uint64
 	Size uint64
 }
 
+// Segment is a range of memory that is loaded from the file.
+type Segment struct {
+	Vaddr  uint64
+	Offset int64
+	Size   uint64
+}
+
+// Section is a section header of the file.
+type Section struct {
+	Index  int // Index in the section header table.
+	Name   string
+	Type   string
+	Addr   uint64
+	Offset uint64
+	Size   uint64
+	Perm   string // e.g. "r-x". Sections that are not loaded have no "r".
+	// Code means that the section is disassembled as code.
+	Code bool
+	// Loaded means that the section is in memory, even at address 0.
+	Loaded bool
+}
+
+// ProgHeader is a program header of the file.
+type ProgHeader struct {
+	Type   string
+	Vaddr  uint64
+	Offset uint64
+	Filesz uint64
+	Memsz  uint64
+	Perm   string
+	// Loaded means that the segment is in a PT_LOAD segment, or is one.
+	Loaded bool
+}
+
+// SymbolKind is the type of a symbol.
+type SymbolKind int
+
+// Symbol kinds.
+const (
+	FuncSymbol SymbolKind = iota
+	ObjectSymbol
+	ImportSymbol
+)
+
+func (k SymbolKind) String() string {
+	return [...]string{"func", "object", "import"}[k]
+}
+
+// Symbol is a named address of the binary.
+type Symbol struct {
+	Name string
+	Addr uint64
+	Size uint64
+	Kind SymbolKind
+}
+
 // Binary type stores information about how to load a file to memory.
 type Binary struct {
 	filename     string
 	memory       []memSegment
+	headers      []memSegment
+	tables       headerTables
+	exts         []*extension
+	extsFound    bool
+	relocCache   *relocCache
 	Symbol2Addr  map[string]uint64
 	Addr2Symbol  map[uint64]string
-	CodeSections []codeSection
+	Symbols      []Symbol
+	Imports      []Import
+	Sections     []Section
+	ProgHeaders  []ProgHeader
+	CodeSections []CodeRegion
+	EHFunctions  []uint64
 	Entry        uint64
 	MachineType  string
+	// Core is the state of the crashed process if the file is a core file.
+	Core *CoreInfo
+	// pid is the process whose memory is loaded, or 0 for files.
+	pid int
+	// readErr is the last failure to read memory that is read on demand.
+	readErr error
+}
+
+// ReadError returns the last failure to read memory, e.g. of a process that
+// exited, and clears it. Such memory reads as nil rather than zeros.
+func (b *Binary) ReadError() error {
+	err := b.readErr
+	b.readErr = nil
+	return err
 }
 
-// Save overwrites the changes into binary.
+// Save overwrites the changes into binary, and panics if it fails.
 func (b *Binary) Save() {
+	if err := b.Commit(); err != nil {
+		panic(err)
+	}
+}
+
+// Commit writes the changes into the file, or into the memory of a process.
+func (b *Binary) Commit() error {
+	if b.pid == 0 {
+		return b.writeChanges()
+	}
+	// A stopped process does not run half-written code.
+	return b.whileStopped(b.writeChanges)
+}
+
+func (b *Binary) writeChanges() error {
 	f, err := os.OpenFile(b.filename, os.O_RDWR, 0644)
 	if err != nil {
-		panic("No such file")
+		return err
 	}
 	defer f.Close()
 
-	for _, m := range b.memory {
-		for idx, val := range m.changes {
-			f.WriteAt([]byte{val}, m.Offset+int64(idx))
+	for _, regions := range [][]memSegment{b.memory, b.headers} {
+		for _, m := range regions {
+			for idx, val := range m.changes {
+				if _, err := f.WriteAt([]byte{val}, m.Offset+int64(idx)); err != nil {
+					return err
+				}
+			}
 		}
 	}
+	return nil
+}
+
+// Segments returns the memory ranges that are backed by the file.
+func (b *Binary) Segments() []Segment {
+	segments := make([]Segment, 0, len(b.memory))
+	for _, m := range b.memory {
+		segments = append(segments, Segment{
+			Vaddr:  m.Vaddr,
+			Offset: m.Offset,
+			Size:   uint64(len(m.Data)),
+		})
+	}
+	return segments
 }
 
-// ReadMemory reads memory bytes from binary.
+// ReadMemory reads memory bytes from binary. Only bytes that are backed by
+// the file can be read.
 func (b *Binary) ReadMemory(addr uint64, size uint64) []uint8 {
+	if size == 0 {
+		return nil
+	}
 	for _, m := range b.memory {
-		if addr >= m.Vaddr && addr < m.Vaddr+m.Memsz {
+		if addr >= m.Vaddr && addr < m.Vaddr+uint64(len(m.Data)) {
+			if err := m.load(int64(addr-m.Vaddr), int64(size)); err != nil {
+				b.readErr = err
+				return nil
+			}
 			if addr-m.Vaddr+size <= uint64(len(m.Data)) {
 				return m.Data[addr-m.Vaddr : addr-m.Vaddr+size]
 			}
@@ -64,28 +193,52 @@ func (b *Binary) ReadMemory(addr uint64, size uint64) []uint8 {
 // WriteMemory write memory bytes into binary. If it tries to write multiple
 // memory segments, only update the first segment.
 func (b *Binary) WriteMemory(addr uint64, data []byte) int {
+	if b.relocCache != nil && b.relocCache.overlaps(addr, uint64(len(data))) {
+		b.invalidateRelocs()
+	}
 	for _, m := range b.memory {
-		if addr >= m.Vaddr && addr < m.Vaddr+m.Memsz {
+		if addr >= m.Vaddr && addr < m.Vaddr+uint64(len(m.Data)) {
+			if m.source != "" {
+				return -1
+			}
 			base := int(addr - m.Vaddr)
-			if base+len(data) <= len(m.Data) {
-				for i := 0; i < len(data); i++ {
-					m.changes[base+i] = data[i]
-					m.Data[base+i] = data[i]
-				}
-				return len(data)
+			size := len(data)
+			if base+size > len(m.Data) {
+				size = len(m.Data) - base
+			}
+			// Bytes that are not patched must be read before they are shown.
+			if err := m.load(int64(base), int64(size)); err != nil {
+				b.readErr = err
+				return -1
 			}
-
-			size := len(m.Data) - base
 			for i := 0; i < size; i++ {
 				m.changes[base+i] = data[i]
 				m.Data[base+i] = data[i]
 			}
+			// Headers may be loaded, e.g. the program headers usually are.
+			b.writeRegions(b.headers, m.Offset+int64(base), data[:size])
+			b.refreshHeaders()
 			return size
 		}
 	}
 	return -1
 }
 
+// clipToFile returns how many of size bytes at offset are in the file.
+func clipToFile(f *os.File, offset int64, size uint64) (uint64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if offset >= info.Size() {
+		return 0, nil
+	}
+	if rest := uint64(info.Size() - offset); size > rest {
+		return rest, nil
+	}
+	return size, nil
+}
+
 func loadCodeSegments(f *os.File, _elf *elf.File) []memSegment {
 	memory := make([]memSegment, 0, len(_elf.Progs))
 	for _, prog := range _elf.Progs {
@@ -102,9 +255,9 @@ func loadCodeSegments(f *os.File, _elf *elf.File) []memSegment {
 		vaddr := prog.Vaddr - pageoffset
 		memsz = (memsz + align) & ^(align - 1)
 
-		f.Seek(offset, os.SEEK_SET)
-		buf := make([]uint8, filesz, filesz)
-		_, err := f.Read(buf)
+		// Segments are mapped instead of read, so that only the pages that are
+		// shown or analyzed are loaded from a large file.
+		buf, err := mapFile(f, offset, filesz)
 		if err != nil {
 			log.Panicln(err)
 		}
@@ -120,44 +273,148 @@ func loadCodeSegments(f *os.File, _elf *elf.File) []memSegment {
 	return memory
 }
 
-func loadSymbols(_elf *elf.File) (map[string]uint64, map[uint64]string) {
+func loadSymbols(_elf *elf.File) (map[string]uint64, map[uint64]string, []Symbol) {
 	symbol2addr := make(map[string]uint64)
 	addr2symbol := make(map[uint64]string)
+	symbolList := make([]Symbol, 0)
 
 	symbols, err := _elf.Symbols()
 	if err != nil {
-		return symbol2addr, addr2symbol
+		return symbol2addr, addr2symbol, symbolList
 	}
 
 	for _, symbol := range symbols {
-		infoType := symbol.Info & 0xf
-		if infoType == 1 || infoType == 2 { // Symbol Type is STT_FUNC or STT_OBJECT
+		infoType := elf.ST_TYPE(symbol.Info)
+		if infoType == elf.STT_FUNC || infoType == elf.STT_OBJECT {
 			symbol2addr[symbol.Name] = symbol.Value
 			addr2symbol[symbol.Value] = symbol.Name
+
+			kind := FuncSymbol
+			if infoType == elf.STT_OBJECT {
+				kind = ObjectSymbol
+			}
+			symbolList = append(symbolList, Symbol{
+				Name: symbol.Name,
+				Addr: symbol.Value,
+				Size: symbol.Size,
+				Kind: kind,
+			})
 		}
 		// TODO: Check Thumb or ARM type for ARM ELFs.
 	}
-	return symbol2addr, addr2symbol
+	return symbol2addr, addr2symbol, symbolList
+}
+
+// mergeSymbols adds the symbols whose names and addresses are not known yet.
+func mergeSymbols(symbol2addr map[string]uint64, addr2symbol map[uint64]string, symbols []Symbol, added []Symbol) []Symbol {
+	for _, symbol := range added {
+		if _, exists := addr2symbol[symbol.Addr]; exists {
+			continue
+		}
+		if _, exists := symbol2addr[symbol.Name]; exists {
+			continue
+		}
+		symbol2addr[symbol.Name] = symbol.Addr
+		addr2symbol[symbol.Addr] = symbol.Name
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// isCodeSection returns true for sections that are disassembled.
+func isCodeSection(section *elf.Section) bool {
+	// We simply assume that every executable section is code section such as
+	// .text, .init, .plt.
+	return section.Flags&elf.SHF_EXECINSTR == elf.SHF_EXECINSTR
+}
+
+func perm(r bool, w bool, x bool) string {
+	b := []byte("---")
+	if r {
+		b[0] = 'r'
+	}
+	if w {
+		b[1] = 'w'
+	}
+	if x {
+		b[2] = 'x'
+	}
+	return string(b)
+}
+
+func loadSections(_elf *elf.File) []Section {
+	sections := make([]Section, 0, len(_elf.Sections))
+	for idx, section := range _elf.Sections {
+		if section.Type == elf.SHT_NULL {
+			continue
+		}
+		sections = append(sections, Section{
+			Index:  idx,
+			Name:   section.Name,
+			Type:   strings.TrimPrefix(section.Type.String(), "SHT_"),
+			Addr:   section.Addr,
+			Offset: section.Offset,
+			Size:   section.Size,
+			Perm: perm(section.Flags&elf.SHF_ALLOC != 0,
+				section.Flags&elf.SHF_WRITE != 0,
+				section.Flags&elf.SHF_EXECINSTR != 0),
+			Code:   isCodeSection(section),
+			Loaded: section.Flags&elf.SHF_ALLOC != 0,
+		})
+	}
+	return sections
 }
 
-func findCodeSection(_elf *elf.File) []codeSection {
-	codeSections := make([]codeSection, 0, len(_elf.Sections)/3)
+func loadProgHeaders(_elf *elf.File) []ProgHeader {
+	progs := make([]ProgHeader, 0, len(_elf.Progs))
+	for _, prog := range _elf.Progs {
+		progs = append(progs, ProgHeader{
+			Type:   strings.TrimPrefix(prog.Type.String(), "PT_"),
+			Vaddr:  prog.Vaddr,
+			Offset: prog.Off,
+			Filesz: prog.Filesz,
+			Memsz:  prog.Memsz,
+			Perm: perm(prog.Flags&elf.PF_R != 0,
+				prog.Flags&elf.PF_W != 0,
+				prog.Flags&elf.PF_X != 0),
+			Loaded: isLoaded(_elf, prog),
+		})
+	}
+	return progs
+}
+
+func isLoaded(_elf *elf.File, prog *elf.Prog) bool {
+	if prog.Memsz == 0 {
+		return false
+	}
+	for _, load := range _elf.Progs {
+		if load.Type == elf.PT_LOAD && prog.Vaddr >= load.Vaddr && prog.Vaddr < load.Vaddr+load.Memsz {
+			return true
+		}
+	}
+	return false
+}
+
+func findCodeSection(_elf *elf.File) []CodeRegion {
+	codeSections := make([]CodeRegion, 0, len(_elf.Sections)/3)
 	for _, section := range _elf.Sections {
-		if section.Flags&elf.SHF_EXECINSTR == elf.SHF_EXECINSTR {
-			// We simply assume that every executable section is code section
-			// such as .text, .init, .plt.
-			codeSections = append(codeSections, codeSection{
+		if isCodeSection(section) {
+			codeSections = append(codeSections, CodeRegion{
 				Addr: section.Addr,
 				Size: section.Size,
 			})
 		}
 	}
+	sortCodeSections(codeSections)
+	return codeSections
+}
+
+func sortCodeSections(codeSections []CodeRegion) {
 	sort.Slice(codeSections, func(i, j int) bool {
 		addr1 := codeSections[i].Addr
 		addr2 := codeSections[j].Addr
 		return addr1 < addr2 || (addr1 == addr2 && codeSections[i].Size < codeSections[j].Size)
 	})
-	return codeSections
 }
 
 // ReadElf loads a ELF binary.
@@ -173,16 +430,31 @@ func ReadElf(filename string) *Binary {
 		panic("Failed to load the ELF file")
 	}
 
+	if _elf.Type == elf.ET_CORE {
+		return readCore(filename, f, _elf, "")
+	}
+
 	memory := loadCodeSegments(f, _elf)
-	symbol2addr, addr2symbol := loadSymbols(_elf)
+	tables, headers := loadHeaders(f, _elf)
+	symbol2addr, addr2symbol, symbols := loadSymbols(_elf)
+	dynSymbols, imports := loadDynamicSymbols(_elf)
+	// Names in .symtab win over dynamic ones.
+	symbols = mergeSymbols(symbol2addr, addr2symbol, symbols, dynSymbols)
 	codeSections := findCodeSection(_elf)
 
 	return &Binary{
 		filename:     filename,
 		memory:       memory,
+		headers:      headers,
+		tables:       tables,
 		Symbol2Addr:  symbol2addr,
 		Addr2Symbol:  addr2symbol,
+		Symbols:      symbols,
+		Imports:      imports,
+		Sections:     loadSections(_elf),
+		ProgHeaders:  loadProgHeaders(_elf),
 		CodeSections: codeSections,
+		EHFunctions:  loadEHFunctions(_elf),
 		Entry:        _elf.Entry,
 		MachineType:  _elf.Machine.String(),
 	}
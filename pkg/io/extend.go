@@ -0,0 +1,315 @@
+package bcio
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+const pageSize = 0x1000
+
+func alignUp(v uint64, align uint64) uint64 {
+	if align <= 1 {
+		return v
+	}
+	return (v + align - 1) &^ (align - 1)
+}
+
+// extensionSpan is the address space that is kept for an extension, so that
+// it can grow after another extension is mapped above it.
+const extensionSpan = 0x1000000
+
+// extension is a loadable segment that is appended to the file for data that
+// does not fit in place, such as a grown string table. The program header
+// table cannot grow in place, so the segment takes over a PT_NOTE header.
+// Code and data go to separate extensions, so that no memory is both
+// writable and executable.
+type extension struct {
+	memIdx  int // Index in Binary.memory.
+	phdrIdx int
+	exec    bool
+}
+
+// noteForExtension returns a PT_NOTE header that can be turned into PT_LOAD.
+// Loaders expect PT_LOAD headers sorted by address, so it has to come after
+// every PT_LOAD, and a note that PT_GNU_PROPERTY also covers is kept.
+func (b *Binary) noteForExtension() (int, error) {
+	notes := b.freeNotes()
+	if len(notes) == 0 {
+		return -1, fmt.Errorf("no PT_NOTE program header to map new data")
+	}
+	property := b.findProgHeaders(elf.PT_GNU_PROPERTY)
+	chosen := notes[len(notes)-1]
+	for _, idx := range notes {
+		if len(property) == 0 || b.headerValue(ProgramHeader, idx, "p_offset") !=
+			b.headerValue(ProgramHeader, property[0], "p_offset") {
+			chosen = idx
+			break
+		}
+	}
+	// The other notes stay after the new PT_LOAD for later extensions.
+	if chosen != notes[0] {
+		b.swapProgHeaders(chosen, notes[0])
+	}
+	return notes[0], nil
+}
+
+var progHeaderFields = []string{
+	"p_type", "p_flags", "p_offset", "p_vaddr", "p_paddr", "p_filesz", "p_memsz", "p_align",
+}
+
+func (b *Binary) swapProgHeaders(i int, j int) {
+	for _, name := range progHeaderFields {
+		vi, vj := b.headerValue(ProgramHeader, i, name), b.headerValue(ProgramHeader, j, name)
+		b.setHeaderValue(ProgramHeader, i, name, vj)
+		b.setHeaderValue(ProgramHeader, j, name, vi)
+	}
+}
+
+// freeNotes returns the PT_NOTE headers after every PT_LOAD.
+func (b *Binary) freeNotes() []int {
+	lastLoad := -1
+	if loads := b.findProgHeaders(elf.PT_LOAD); len(loads) > 0 {
+		lastLoad = loads[len(loads)-1]
+	}
+	notes := make([]int, 0)
+	for _, idx := range b.findProgHeaders(elf.PT_NOTE) {
+		if idx > lastLoad {
+			notes = append(notes, idx)
+		}
+	}
+	return notes
+}
+
+// findExtensions finds the extensions of an earlier edit, which are the last
+// PT_LOADs that end the file one after another and have no zero-filled
+// memory.
+func (b *Binary) findExtensions() {
+	b.extsFound = true
+	loads := b.findProgHeaders(elf.PT_LOAD)
+	end := uint64(b.tables.fileSize)
+	for i := len(loads) - 1; i >= 0 && len(b.exts) < 2; i-- {
+		phdrIdx := loads[i]
+		offset := b.headerValue(ProgramHeader, phdrIdx, "p_offset")
+		vaddr := b.headerValue(ProgramHeader, phdrIdx, "p_vaddr")
+		filesz := b.headerValue(ProgramHeader, phdrIdx, "p_filesz")
+		exec := elf.ProgFlag(b.headerValue(ProgramHeader, phdrIdx, "p_flags"))&elf.PF_X != 0
+		if offset%pageSize != 0 || vaddr%pageSize != 0 ||
+			offset+filesz > end || alignUp(offset+filesz, pageSize) < end ||
+			filesz != b.headerValue(ProgramHeader, phdrIdx, "p_memsz") ||
+			(len(b.exts) != 0 && b.exts[0].exec == exec) {
+			return
+		}
+		memIdx := -1
+		for idx, m := range b.memory {
+			if m.Vaddr == vaddr && m.Offset == int64(offset) {
+				memIdx = idx
+			}
+		}
+		if memIdx < 0 {
+			return
+		}
+		b.exts = append(b.exts, &extension{memIdx: memIdx, phdrIdx: phdrIdx, exec: exec})
+		end = offset
+	}
+}
+
+// newExtensionsNeeded returns how many extensions have to be created for
+// new data, and for new code if withCode is set.
+func (b *Binary) newExtensionsNeeded(withCode bool) int {
+	if !b.extsFound {
+		b.findExtensions()
+	}
+	needed := 1
+	if withCode {
+		needed = 2
+	}
+	for _, ext := range b.exts {
+		if !ext.exec || withCode {
+			needed--
+		}
+	}
+	return needed
+}
+
+// extensionFor returns the extension for code or for data.
+func (b *Binary) extensionFor(exec bool) (*extension, error) {
+	if !b.extsFound {
+		b.findExtensions()
+	}
+	for _, ext := range b.exts {
+		if ext.exec == exec {
+			return ext, nil
+		}
+	}
+	return b.newExtension(exec)
+}
+
+// nextExtensionAddr returns the address of a new extension, which is above
+// every other segment and the space that is kept for other extensions.
+func (b *Binary) nextExtensionAddr() uint64 {
+	var end uint64
+	for _, idx := range b.findProgHeaders(elf.PT_LOAD) {
+		vaddr := b.headerValue(ProgramHeader, idx, "p_vaddr")
+		if e := vaddr + b.headerValue(ProgramHeader, idx, "p_memsz"); e > end {
+			end = e
+		}
+	}
+	for _, ext := range b.exts {
+		if e := b.memory[ext.memIdx].Vaddr + extensionSpan; e > end {
+			end = e
+		}
+	}
+	return alignUp(end, pageSize)
+}
+
+// newExtension maps an empty segment after the end of the file.
+func (b *Binary) newExtension(exec bool) (*extension, error) {
+	phdrIdx, err := b.noteForExtension()
+	if err != nil {
+		return nil, err
+	}
+	offset := alignUp(uint64(b.tables.fileSize), pageSize)
+	vaddr := b.nextExtensionAddr()
+
+	b.memory = append(b.memory, memSegment{
+		Vaddr:   vaddr,
+		Offset:  int64(offset),
+		Data:    make([]byte, 0),
+		changes: make(map[int]byte),
+	})
+	ext := &extension{memIdx: len(b.memory) - 1, phdrIdx: phdrIdx, exec: exec}
+	b.exts = append(b.exts, ext)
+
+	for name, value := range map[string]uint64{
+		"p_type":   uint64(elf.PT_LOAD),
+		"p_flags":  uint64(elf.PF_R),
+		"p_offset": offset,
+		"p_vaddr":  vaddr,
+		"p_paddr":  vaddr,
+		"p_filesz": 0,
+		"p_memsz":  0,
+		"p_align":  pageSize,
+	} {
+		b.setHeaderValue(ProgramHeader, phdrIdx, name, value)
+	}
+	return ext, nil
+}
+
+// shiftExtension moves an extension delta bytes further into the file, with
+// the headers that point into it, to make room for the one before it. Its
+// bytes are written again when the file is saved.
+func (b *Binary) shiftExtension(ext *extension, delta int64) {
+	m := &b.memory[ext.memIdx]
+	start, end := uint64(m.Offset), uint64(m.Offset)+uint64(len(m.Data))
+	for idx := 0; idx < b.HeaderCount(ProgramHeader); idx++ {
+		off := b.headerValue(ProgramHeader, idx, "p_offset")
+		if idx == ext.phdrIdx || (off >= start && off < end) {
+			b.setHeaderValue(ProgramHeader, idx, "p_offset", off+uint64(delta))
+		}
+	}
+	for idx := 1; idx < b.HeaderCount(SectionHeader); idx++ {
+		if off := b.headerValue(SectionHeader, idx, "sh_offset"); off >= start && off < end {
+			b.setHeaderValue(SectionHeader, idx, "sh_offset", off+uint64(delta))
+		}
+	}
+	m.Offset += delta
+	for i, v := range m.Data {
+		m.changes[i] = v
+	}
+	if fileEnd := m.Offset + int64(len(m.Data)); fileEnd > b.tables.fileSize {
+		b.tables.fileSize = fileEnd
+	}
+}
+
+// Allocate reserves size bytes of new loaded memory with the given
+// permissions, and returns the address. The bytes are appended to the file
+// when it is saved. Executable memory is kept apart from other memory, and
+// memory that is both writable and executable is refused.
+func (b *Binary) Allocate(size uint64, align uint64, flags elf.ProgFlag) (uint64, error) {
+	if flags&elf.PF_W != 0 && flags&elf.PF_X != 0 {
+		return 0, fmt.Errorf("new memory cannot be both writable and executable")
+	}
+	ext, err := b.extensionFor(flags&elf.PF_X != 0)
+	if err != nil {
+		return 0, err
+	}
+	m := &b.memory[ext.memIdx]
+	start := alignUp(uint64(len(m.Data)), align)
+	end := start + size
+	for _, other := range b.exts {
+		o := b.memory[other.memIdx]
+		if o.Vaddr > m.Vaddr && m.Vaddr+end > o.Vaddr {
+			return 0, fmt.Errorf("no room for 0x%x bytes of new memory", size)
+		}
+	}
+	for _, other := range b.exts {
+		o := b.memory[other.memIdx]
+		fileEnd := int64(alignUp(uint64(m.Offset)+end, pageSize))
+		if o.Offset > m.Offset && fileEnd > o.Offset {
+			b.shiftExtension(other, fileEnd-o.Offset)
+		}
+	}
+
+	for i := uint64(len(m.Data)); i < end; i++ {
+		// New bytes are changes even if they stay zero.
+		m.Data = append(m.Data, 0)
+		m.changes[int(i)] = 0
+	}
+	m.Memsz = alignUp(end, pageSize)
+	if fileEnd := m.Offset + int64(end); fileEnd > b.tables.fileSize {
+		b.tables.fileSize = fileEnd
+	}
+
+	phdrIdx := ext.phdrIdx
+	b.setHeaderValue(ProgramHeader, phdrIdx, "p_filesz", end)
+	b.setHeaderValue(ProgramHeader, phdrIdx, "p_memsz", end)
+	oldFlags := b.headerValue(ProgramHeader, phdrIdx, "p_flags")
+	b.setHeaderValue(ProgramHeader, phdrIdx, "p_flags", oldFlags|uint64(flags))
+	return m.Vaddr + start, nil
+}
+
+// NextAllocation returns the address that Allocate returns for the same
+// alignment and permissions, without allocating. Code can be assembled for
+// its final address before the binary is changed.
+func (b *Binary) NextAllocation(align uint64, flags elf.ProgFlag) (uint64, error) {
+	if !b.extsFound {
+		b.findExtensions()
+	}
+	exec := flags&elf.PF_X != 0
+	for _, ext := range b.exts {
+		if ext.exec == exec {
+			m := b.memory[ext.memIdx]
+			return m.Vaddr + alignUp(uint64(len(m.Data)), align), nil
+		}
+	}
+	if len(b.freeNotes()) == 0 {
+		return 0, fmt.Errorf("no PT_NOTE program header to map new data")
+	}
+	return b.nextExtensionAddr(), nil
+}
+
+// endsExtension returns true if [addr, addr+size) is the end of the new
+// memory with the given permissions, so that the next allocation of bytes
+// extends it.
+func (b *Binary) endsExtension(addr uint64, size uint64, flags elf.ProgFlag) bool {
+	if !b.extsFound {
+		b.findExtensions()
+	}
+	for _, ext := range b.exts {
+		m := b.memory[ext.memIdx]
+		if ext.exec == (flags&elf.PF_X != 0) {
+			return addr >= m.Vaddr && addr+size == m.Vaddr+uint64(len(m.Data))
+		}
+	}
+	return false
+}
+
+// offsetOf returns the file offset of a loaded address.
+func (b *Binary) offsetOf(addr uint64) (int64, bool) {
+	for _, m := range b.memory {
+		if addr >= m.Vaddr && addr < m.Vaddr+uint64(len(m.Data)) {
+			return m.Offset + int64(addr-m.Vaddr), true
+		}
+	}
+	return 0, false
+}
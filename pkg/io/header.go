@@ -0,0 +1,488 @@
+package bcio
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// HeaderKind is a kind of ELF header.
+type HeaderKind int
+
+// Header kinds.
+const (
+	FileHeader HeaderKind = iota
+	ProgramHeader
+	SectionHeader
+)
+
+// HeaderField is a field of the ELF header, a program header or a section
+// header.
+type HeaderField struct {
+	Name     string
+	Offset   int64 // File offset.
+	Size     int
+	Value    uint64
+	Desc     string // Decoded value such as "LOAD" or "r-x", if any.
+	ReadOnly bool
+}
+
+// fieldLayout places a field in ELF32 and ELF64 headers. Fields that define
+// where the header tables are cannot be edited, since the tables are loaded
+// once.
+type fieldLayout struct {
+	name     string
+	off32    int
+	size32   int
+	off64    int
+	size64   int
+	readOnly bool
+}
+
+var fileHeaderLayout = []fieldLayout{
+	{"e_type", 16, 2, 16, 2, false},
+	{"e_machine", 18, 2, 18, 2, true},
+	{"e_version", 20, 4, 20, 4, false},
+	{"e_entry", 24, 4, 24, 8, false},
+	{"e_phoff", 28, 4, 32, 8, true},
+	{"e_shoff", 32, 4, 40, 8, true},
+	{"e_flags", 36, 4, 48, 4, false},
+	{"e_ehsize", 40, 2, 52, 2, true},
+	{"e_phentsize", 42, 2, 54, 2, true},
+	{"e_phnum", 44, 2, 56, 2, true},
+	{"e_shentsize", 46, 2, 58, 2, true},
+	{"e_shnum", 48, 2, 60, 2, true},
+	{"e_shstrndx", 50, 2, 62, 2, false},
+}
+
+var progHeaderLayout = []fieldLayout{
+	{"p_type", 0, 4, 0, 4, false},
+	{"p_flags", 24, 4, 4, 4, false},
+	{"p_offset", 4, 4, 8, 8, false},
+	{"p_vaddr", 8, 4, 16, 8, false},
+	{"p_paddr", 12, 4, 24, 8, false},
+	{"p_filesz", 16, 4, 32, 8, false},
+	{"p_memsz", 20, 4, 40, 8, false},
+	{"p_align", 28, 4, 48, 8, false},
+}
+
+var sectionHeaderLayout = []fieldLayout{
+	{"sh_name", 0, 4, 0, 4, false},
+	{"sh_type", 4, 4, 4, 4, false},
+	{"sh_flags", 8, 4, 8, 8, false},
+	{"sh_addr", 12, 4, 16, 8, false},
+	{"sh_offset", 16, 4, 24, 8, false},
+	{"sh_size", 20, 4, 32, 8, false},
+	{"sh_link", 24, 4, 40, 4, false},
+	{"sh_info", 28, 4, 44, 4, false},
+	{"sh_addralign", 32, 4, 48, 8, false},
+	{"sh_entsize", 36, 4, 56, 8, false},
+}
+
+// headerTables locates the header tables in the file. The headers are kept as
+// file regions apart from memory, since the section header table is usually
+// not loaded.
+type headerTables struct {
+	class     elf.Class
+	order     binary.ByteOrder
+	fileSize  int64
+	phoff     int64
+	phentsize int64
+	phnum     int
+	shoff     int64
+	shentsize int64
+	shnum     int
+}
+
+func readRegion(f *os.File, offset int64, size int64) memSegment {
+	buf := make([]byte, size)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		panic("Failed to read ELF headers")
+	}
+	return memSegment{Offset: offset, Data: buf, changes: make(map[int]byte)}
+}
+
+// loadHeaders reads the ELF header and the header tables as file regions.
+func loadHeaders(f *os.File, _elf *elf.File) (headerTables, []memSegment) {
+	info, err := f.Stat()
+	if err != nil {
+		panic(err)
+	}
+	t := headerTables{
+		class:    _elf.Class,
+		order:    _elf.ByteOrder,
+		fileSize: info.Size(),
+	}
+	ehsize := int64(52)
+	if t.class == elf.ELFCLASS64 {
+		ehsize = 64
+	}
+	regions := []memSegment{readRegion(f, 0, ehsize)}
+
+	field := func(name string) uint64 {
+		for _, l := range fileHeaderLayout {
+			if l.name == name {
+				off, size := t.place(l)
+				return t.decode(regions[0].Data[off : off+int64(size)])
+			}
+		}
+		panic(name)
+	}
+	t.phoff = int64(field("e_phoff"))
+	t.phentsize = int64(field("e_phentsize"))
+	t.phnum = int(field("e_phnum"))
+	t.shoff = int64(field("e_shoff"))
+	t.shentsize = int64(field("e_shentsize"))
+	t.shnum = int(field("e_shnum"))
+
+	if size := t.phentsize * int64(t.phnum); size > 0 && t.phoff+size <= t.fileSize {
+		regions = append(regions, readRegion(f, t.phoff, size))
+	} else {
+		t.phnum = 0
+	}
+	if size := t.shentsize * int64(t.shnum); size > 0 && t.shoff+size <= t.fileSize {
+		regions = append(regions, readRegion(f, t.shoff, size))
+	} else {
+		t.shnum = 0
+	}
+	return t, regions
+}
+
+func (t *headerTables) place(l fieldLayout) (int64, int) {
+	if t.class == elf.ELFCLASS64 {
+		return int64(l.off64), l.size64
+	}
+	return int64(l.off32), l.size32
+}
+
+func (t *headerTables) decode(b []byte) uint64 {
+	switch len(b) {
+	case 2:
+		return uint64(t.order.Uint16(b))
+	case 4:
+		return uint64(t.order.Uint32(b))
+	case 8:
+		return t.order.Uint64(b)
+	}
+	return 0
+}
+
+func (t *headerTables) encode(value uint64, size int) []byte {
+	b := make([]byte, size)
+	switch size {
+	case 2:
+		t.order.PutUint16(b, uint16(value))
+	case 4:
+		t.order.PutUint32(b, uint32(value))
+	case 8:
+		t.order.PutUint64(b, value)
+	}
+	return b
+}
+
+// HeaderCount returns the number of headers of a kind.
+func (b *Binary) HeaderCount(kind HeaderKind) int {
+	switch kind {
+	case FileHeader:
+		return 1
+	case ProgramHeader:
+		return b.tables.phnum
+	case SectionHeader:
+		return b.tables.shnum
+	}
+	return 0
+}
+
+func (b *Binary) headerBase(kind HeaderKind, idx int) (int64, []fieldLayout, error) {
+	if idx < 0 || idx >= b.HeaderCount(kind) {
+		return 0, nil, fmt.Errorf("no such header: %d", idx)
+	}
+	switch kind {
+	case ProgramHeader:
+		return b.tables.phoff + int64(idx)*b.tables.phentsize, progHeaderLayout, nil
+	case SectionHeader:
+		return b.tables.shoff + int64(idx)*b.tables.shentsize, sectionHeaderLayout, nil
+	}
+	return 0, fileHeaderLayout, nil
+}
+
+func describeField(name string, value uint64) string {
+	switch name {
+	case "e_type":
+		return strings.TrimPrefix(elf.Type(value).String(), "ET_")
+	case "p_type":
+		return strings.TrimPrefix(elf.ProgType(value).String(), "PT_")
+	case "p_flags":
+		flags := elf.ProgFlag(value)
+		return perm(flags&elf.PF_R != 0, flags&elf.PF_W != 0, flags&elf.PF_X != 0)
+	case "sh_type":
+		return strings.TrimPrefix(elf.SectionType(value).String(), "SHT_")
+	case "sh_flags":
+		return strings.Replace(elf.SectionFlag(value).String(), "SHF_", "", -1)
+	}
+	return ""
+}
+
+// HeaderFields returns the fields of a header with their current values.
+func (b *Binary) HeaderFields(kind HeaderKind, idx int) ([]HeaderField, error) {
+	base, layout, err := b.headerBase(kind, idx)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]HeaderField, 0, len(layout))
+	for _, l := range layout {
+		off, size := b.tables.place(l)
+		value := b.tables.decode(b.ReadFile(base+off, size))
+		fields = append(fields, HeaderField{
+			Name:     l.name,
+			Offset:   base + off,
+			Size:     size,
+			Value:    value,
+			Desc:     describeField(l.name, value),
+			ReadOnly: l.readOnly,
+		})
+	}
+	return fields, nil
+}
+
+// HeaderField returns a field of a header by its name, e.g. "p_flags".
+func (b *Binary) HeaderField(kind HeaderKind, idx int, name string) (HeaderField, error) {
+	fields, err := b.HeaderFields(kind, idx)
+	if err != nil {
+		return HeaderField{}, err
+	}
+	for _, f := range fields {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return HeaderField{}, fmt.Errorf("no such field: %s", name)
+}
+
+// SetHeaderField validates and writes a field of a header. The change is
+// saved with the other patches.
+func (b *Binary) SetHeaderField(kind HeaderKind, idx int, name string, value uint64) error {
+	fields, err := b.HeaderFields(kind, idx)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]uint64, len(fields))
+	var field *HeaderField
+	for i := range fields {
+		values[fields[i].Name] = fields[i].Value
+		if fields[i].Name == name {
+			field = &fields[i]
+		}
+	}
+	if field == nil {
+		return fmt.Errorf("no such field: %s", name)
+	}
+	if field.ReadOnly {
+		return fmt.Errorf("%s cannot be changed", name)
+	}
+	if field.Size < 8 && value>>(8*uint(field.Size)) != 0 {
+		return fmt.Errorf("%s is a %d-byte field", name, field.Size)
+	}
+	values[name] = value
+	if err := b.validateHeader(kind, values); err != nil {
+		return err
+	}
+
+	b.WriteFile(field.Offset, b.tables.encode(value, field.Size))
+	return nil
+}
+
+func isPowerOfTwo(v uint64) bool {
+	return v&(v-1) == 0
+}
+
+// validateHeader checks a header with a changed field.
+func (b *Binary) validateHeader(kind HeaderKind, v map[string]uint64) error {
+	switch kind {
+	case FileHeader:
+		if t := v["e_type"]; t > uint64(elf.ET_CORE) && t < uint64(elf.ET_LOOS) {
+			return fmt.Errorf("invalid e_type: 0x%x", t)
+		}
+		if v["e_shstrndx"] >= uint64(b.tables.shnum) && v["e_shstrndx"] != uint64(elf.SHN_UNDEF) {
+			return fmt.Errorf("e_shstrndx is out of the section headers")
+		}
+		if entry := v["e_entry"]; entry != 0 && !b.isExecAddr(entry) {
+			return fmt.Errorf("e_entry is not in an executable segment")
+		}
+	case ProgramHeader:
+		const knownFlags = elf.PF_R | elf.PF_W | elf.PF_X | elf.PF_MASKOS | elf.PF_MASKPROC
+		if v["p_flags"]&^uint64(knownFlags) != 0 {
+			return fmt.Errorf("unknown bits in p_flags: 0x%x", v["p_flags"])
+		}
+		if v["p_offset"]+v["p_filesz"] > uint64(b.tables.fileSize) {
+			return fmt.Errorf("segment is out of the file")
+		}
+		if !isPowerOfTwo(v["p_align"]) {
+			return fmt.Errorf("p_align is not a power of two")
+		}
+		if v["p_type"] == uint64(elf.PT_LOAD) {
+			if v["p_filesz"] > v["p_memsz"] {
+				return fmt.Errorf("p_filesz is larger than p_memsz")
+			}
+			if align := v["p_align"]; align > 1 && v["p_vaddr"]%align != v["p_offset"]%align {
+				return fmt.Errorf("p_vaddr and p_offset are not congruent modulo p_align")
+			}
+		}
+	case SectionHeader:
+		if v["sh_type"] != uint64(elf.SHT_NOBITS) && v["sh_offset"]+v["sh_size"] > uint64(b.tables.fileSize) {
+			return fmt.Errorf("section is out of the file")
+		}
+		if !isPowerOfTwo(v["sh_addralign"]) {
+			return fmt.Errorf("sh_addralign is not a power of two")
+		}
+		if v["sh_link"] >= uint64(b.tables.shnum) {
+			return fmt.Errorf("sh_link is out of the section headers")
+		}
+	}
+	return nil
+}
+
+// isExecAddr returns true if addr is in an executable loadable segment.
+func (b *Binary) isExecAddr(addr uint64) bool {
+	for _, prog := range b.ProgHeaders {
+		if prog.Type == "LOAD" && strings.HasSuffix(prog.Perm, "x") &&
+			addr >= prog.Vaddr && addr < prog.Vaddr+prog.Memsz {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFile reads bytes at a file offset from the header regions or the
+// loaded segments.
+func (b *Binary) ReadFile(offset int64, size int) []byte {
+	for _, regions := range [][]memSegment{b.headers, b.memory} {
+		for _, m := range regions {
+			if offset >= m.Offset && offset+int64(size) <= m.Offset+int64(len(m.Data)) {
+				if err := m.load(offset-m.Offset, int64(size)); err != nil {
+					b.readErr = err
+					return nil
+				}
+				return m.Data[offset-m.Offset : offset-m.Offset+int64(size)]
+			}
+		}
+	}
+	return nil
+}
+
+// WriteFile writes bytes at a file offset. Every header region and loaded
+// segment that holds the offset is updated, so that they stay the same.
+func (b *Binary) WriteFile(offset int64, data []byte) {
+	// Headers may move the dynamic section or the relocation tables.
+	b.invalidateRelocs()
+	b.writeRegions(b.memory, offset, data)
+	b.writeRegions(b.headers, offset, data)
+	b.refreshHeaders()
+}
+
+func (b *Binary) writeRegions(regions []memSegment, offset int64, data []byte) {
+	for _, m := range regions {
+		if err := m.load(offset-m.Offset, int64(len(data))); err != nil {
+			b.readErr = err
+			continue
+		}
+		for i, val := range data {
+			if idx := offset + int64(i) - m.Offset; idx >= 0 && idx < int64(len(m.Data)) {
+				m.changes[int(idx)] = val
+				m.Data[idx] = val
+			}
+		}
+	}
+}
+
+// refreshHeaders updates the parsed headers after their bytes are changed.
+// Memory is loaded once, so changed segments take effect after reloading.
+func (b *Binary) refreshHeaders() {
+	// The memory of a process has no file headers.
+	if len(b.headers) == 0 {
+		return
+	}
+	value := func(fields []HeaderField, name string) uint64 {
+		for _, f := range fields {
+			if f.Name == name {
+				return f.Value
+			}
+		}
+		return 0
+	}
+
+	// Core files have no entry, and show the faulting instruction instead.
+	if fields, err := b.HeaderFields(FileHeader, 0); err == nil && b.Core == nil {
+		b.Entry = value(fields, "e_entry")
+	}
+	for i := range b.ProgHeaders {
+		fields, err := b.HeaderFields(ProgramHeader, i)
+		if err != nil {
+			break
+		}
+		prog := &b.ProgHeaders[i]
+		prog.Type = describeField("p_type", value(fields, "p_type"))
+		prog.Vaddr = value(fields, "p_vaddr")
+		prog.Offset = value(fields, "p_offset")
+		prog.Filesz = value(fields, "p_filesz")
+		prog.Memsz = value(fields, "p_memsz")
+		prog.Perm = describeField("p_flags", value(fields, "p_flags"))
+	}
+	for i := range b.Sections {
+		section := &b.Sections[i]
+		fields, err := b.HeaderFields(SectionHeader, section.Index)
+		if err != nil {
+			continue
+		}
+		flags := elf.SectionFlag(value(fields, "sh_flags"))
+		section.Type = describeField("sh_type", value(fields, "sh_type"))
+		section.Addr = value(fields, "sh_addr")
+		section.Offset = value(fields, "sh_offset")
+		section.Size = value(fields, "sh_size")
+		section.Perm = perm(flags&elf.SHF_ALLOC != 0, flags&elf.SHF_WRITE != 0, flags&elf.SHF_EXECINSTR != 0)
+	}
+}
+
+// headerValue returns a field of a header, or 0 if there is no such field.
+func (b *Binary) headerValue(kind HeaderKind, idx int, name string) uint64 {
+	f, err := b.HeaderField(kind, idx, name)
+	if err != nil {
+		return 0
+	}
+	return f.Value
+}
+
+// setHeaderValue writes a field without validation, for edits that change
+// several fields together.
+func (b *Binary) setHeaderValue(kind HeaderKind, idx int, name string, value uint64) {
+	f, err := b.HeaderField(kind, idx, name)
+	if err != nil {
+		log.Panicln(err)
+	}
+	b.WriteFile(f.Offset, b.tables.encode(value, f.Size))
+}
+
+// findProgHeaders returns the indexes of program headers of a type.
+func (b *Binary) findProgHeaders(typ elf.ProgType) []int {
+	found := make([]int, 0)
+	for idx := 0; idx < b.HeaderCount(ProgramHeader); idx++ {
+		if elf.ProgType(b.headerValue(ProgramHeader, idx, "p_type")) == typ {
+			found = append(found, idx)
+		}
+	}
+	return found
+}
+
+// findSectionAt returns the index of the section header at addr, or -1.
+func (b *Binary) findSectionAt(typ elf.SectionType, addr uint64) int {
+	for idx := 1; idx < b.HeaderCount(SectionHeader); idx++ {
+		if elf.SectionType(b.headerValue(SectionHeader, idx, "sh_type")) == typ &&
+			b.headerValue(SectionHeader, idx, "sh_addr") == addr {
+			return idx
+		}
+	}
+	return -1
+}
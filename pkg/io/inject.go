@@ -0,0 +1,312 @@
+package bcio
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// relocTable is the DT_RELA or DT_REL table of the dynamic section.
+type relocTable struct {
+	addrTag elf.DynTag
+	sizeTag elf.DynTag
+	entTag  elf.DynTag
+	rela    bool
+}
+
+func (b *Binary) ptrSize() int {
+	if b.tables.class == elf.ELFCLASS64 {
+		return 8
+	}
+	return 4
+}
+
+func (b *Binary) relocEntSize(rela bool) int {
+	if rela {
+		return b.ptrSize() * 3
+	}
+	return b.ptrSize() * 2
+}
+
+// relativeRelocType returns the type of relocations that add the load base.
+func (b *Binary) relativeRelocType() (uint32, bool) {
+	switch b.MachineType {
+	case "EM_X86_64":
+		return uint32(elf.R_X86_64_RELATIVE), true
+	case "EM_386":
+		return uint32(elf.R_386_RELATIVE), true
+	case "EM_AARCH64":
+		return uint32(elf.R_AARCH64_RELATIVE), true
+	}
+	return 0, false
+}
+
+// isPIE returns true if the binary is loaded at a random base, so that
+// addresses in data need relative relocations.
+func (b *Binary) isPIE() bool {
+	return elf.Type(b.headerValue(FileHeader, 0, "e_type")) == elf.ET_DYN
+}
+
+// findRelocTable returns the table of the dynamic relocations. Binaries
+// without one get the kind that the architecture uses.
+func (b *Binary) findRelocTable(entries []DynEntry) relocTable {
+	rela := relocTable{elf.DT_RELA, elf.DT_RELASZ, elf.DT_RELAENT, true}
+	rel := relocTable{elf.DT_REL, elf.DT_RELSZ, elf.DT_RELENT, false}
+	if _, ok := dynValue(entries, elf.DT_RELA); ok {
+		return rela
+	}
+	if _, ok := dynValue(entries, elf.DT_REL); ok || b.MachineType == "EM_386" {
+		return rel
+	}
+	return rela
+}
+
+// readRelocTable reads the dynamic relocations from memory.
+func (b *Binary) readRelocTable(entries []DynEntry, table relocTable) ([]Relocation, uint64) {
+	addr, ok := dynValue(entries, table.addrTag)
+	size, _ := dynValue(entries, table.sizeTag)
+	if !ok {
+		return nil, 0
+	}
+	return b.readRelocs(addr, size, table.rela), addr
+}
+
+func (b *Binary) readRelocs(addr uint64, size uint64, rela bool) []Relocation {
+	data := b.ReadMemory(addr, size)
+	ptr := b.ptrSize()
+	entSize := b.relocEntSize(rela)
+	relocs := make([]Relocation, 0, len(data)/entSize)
+	for off := 0; off+entSize <= len(data); off += entSize {
+		info := b.tables.decode(data[off+ptr : off+2*ptr])
+		reloc := Relocation{
+			Addr:   addr + uint64(off),
+			Offset: b.tables.decode(data[off : off+ptr]),
+			Rela:   rela,
+		}
+		if ptr == 8 {
+			reloc.Type = uint32(info)
+			reloc.Sym = uint32(info >> 32)
+		} else {
+			reloc.Type = uint32(info & 0xff)
+			reloc.Sym = uint32(info >> 8)
+		}
+		if rela {
+			reloc.Addend = int64(b.tables.decode(data[off+2*ptr : off+3*ptr]))
+		}
+		relocs = append(relocs, reloc)
+	}
+	return relocs
+}
+
+// setDynValue changes the value of a tag, or adds the tag.
+func setDynValue(entries []DynEntry, tag elf.DynTag, value uint64) []DynEntry {
+	for i := range entries {
+		if entries[i].Tag == tag {
+			entries[i].Value = value
+			return entries
+		}
+	}
+	return insertDynEntry(entries, DynEntry{Tag: tag, Value: value})
+}
+
+// addRelocations copies the dynamic relocations with new ones appended to
+// new memory. Relative relocations that DT_RELACOUNT counts stay first.
+func (b *Binary) addRelocations(entries []DynEntry, added []Relocation) ([]DynEntry, error) {
+	table := b.findRelocTable(entries)
+	relocs, oldAddr := b.readRelocTable(entries, table)
+	relocs = append(relocs, added...)
+
+	data := make([]byte, 0, len(relocs)*b.relocEntSize(table.rela))
+	for _, reloc := range relocs {
+		data = append(data, b.encodeRelocation(reloc, table.rela)...)
+	}
+	addr, err := b.Allocate(uint64(len(data)), uint64(b.ptrSize()), elf.PF_R)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteMemory(addr, data)
+
+	typ := elf.SHT_REL
+	if table.rela {
+		typ = elf.SHT_RELA
+	}
+	b.moveSection(typ, oldAddr, addr, uint64(len(data)))
+	b.invalidateRelocs()
+	entries = setDynValue(entries, table.addrTag, addr)
+	entries = setDynValue(entries, table.sizeTag, uint64(len(data)))
+	return setDynValue(entries, table.entTag, uint64(b.relocEntSize(table.rela))), nil
+}
+
+// initArrayTargets returns the functions of DT_INIT_ARRAY as addresses before
+// relocation.
+func (b *Binary) initArrayTargets(entries []DynEntry) []uint64 {
+	addr, ok := dynValue(entries, elf.DT_INIT_ARRAY)
+	size, _ := dynValue(entries, elf.DT_INIT_ARRAYSZ)
+	if !ok {
+		return nil
+	}
+	table := b.findRelocTable(entries)
+	relocs, _ := b.readRelocTable(entries, table)
+	relative, _ := b.relativeRelocType()
+	addends := make(map[uint64]uint64)
+	for _, reloc := range relocs {
+		if table.rela && reloc.Type == relative {
+			addends[reloc.Offset] = uint64(reloc.Addend)
+		}
+	}
+
+	ptr := uint64(b.ptrSize())
+	data := b.ReadMemory(addr, size)
+	targets := make([]uint64, 0, size/ptr)
+	for off := uint64(0); off+ptr <= uint64(len(data)); off += ptr {
+		// SHT_REL and DT_RELR relocations add the base to the stored address.
+		target := b.tables.decode(data[off : off+ptr])
+		if addend, exists := addends[addr+off]; exists {
+			target = addend
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// AddInitFunction makes the loader call the function at addr before the
+// constructors of the binary. DT_INIT_ARRAY is copied to new memory with addr
+// prepended, and a position independent binary gets relative relocations
+// for the copy.
+func (b *Binary) AddInitFunction(addr uint64) error {
+	entries, err := b.readDynamic()
+	if err != nil {
+		return err
+	}
+	funcs := append([]uint64{addr}, b.initArrayTargets(entries)...)
+	oldAddr, _ := dynValue(entries, elf.DT_INIT_ARRAY)
+
+	ptr := b.ptrSize()
+	data := make([]byte, 0, len(funcs)*ptr)
+	for _, f := range funcs {
+		data = append(data, b.tables.encode(f, ptr)...)
+	}
+	// Relocations write to the array.
+	arrAddr, err := b.Allocate(uint64(len(data)), uint64(ptr), elf.PF_R|elf.PF_W)
+	if err != nil {
+		return err
+	}
+	b.WriteMemory(arrAddr, data)
+	b.moveSection(elf.SHT_INIT_ARRAY, oldAddr, arrAddr, uint64(len(data)))
+
+	if b.isPIE() {
+		relative, ok := b.relativeRelocType()
+		if !ok {
+			return fmt.Errorf("relocations of %s are not supported", b.MachineType)
+		}
+		added := make([]Relocation, len(funcs))
+		for i, f := range funcs {
+			added[i] = Relocation{Offset: arrAddr + uint64(i*ptr), Type: relative, Addend: int64(f)}
+		}
+		if entries, err = b.addRelocations(entries, added); err != nil {
+			return err
+		}
+	}
+	entries = setDynValue(entries, elf.DT_INIT_ARRAY, arrAddr)
+	entries = setDynValue(entries, elf.DT_INIT_ARRAYSZ, uint64(len(data)))
+	return b.writeDynamic(entries)
+}
+
+// CanInject checks that lib can be added as a needed library, and that an
+// init function can be added if withInit is set, so that an injection does
+// not fail half way.
+func (b *Binary) CanInject(lib string, withInit bool) error {
+	if lib == "" || strings.IndexByte(lib, 0) >= 0 {
+		return fmt.Errorf("invalid library: %q", lib)
+	}
+	current, err := b.DynamicEntries()
+	if err != nil {
+		return err
+	}
+	for _, e := range current {
+		if e.Tag == elf.DT_NEEDED && e.Str == lib {
+			return fmt.Errorf("%s is already needed", lib)
+		}
+	}
+	if len(b.freeNotes()) < b.newExtensionsNeeded(withInit) {
+		return fmt.Errorf("no PT_NOTE program header to map new data")
+	}
+	if withInit && b.isPIE() {
+		if _, ok := b.relativeRelocType(); !ok {
+			return fmt.Errorf("relocations of %s are not supported", b.MachineType)
+		}
+	}
+	return nil
+}
+
+// CheckInjection parses a saved file with debug/elf, and checks that lib is
+// needed and that the first function of DT_INIT_ARRAY is init, unless init is
+// 0.
+func CheckInjection(filename string, lib string, init uint64) error {
+	f, err := elf.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, l := range libs {
+		found = found || l == lib
+	}
+	if !found {
+		return fmt.Errorf("%s is not needed", lib)
+	}
+	if init == 0 {
+		return nil
+	}
+
+	ptr := 4
+	if f.Class == elf.ELFCLASS64 {
+		ptr = 8
+	}
+	read := func(addr uint64, size int) ([]byte, error) {
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_LOAD && addr >= prog.Vaddr && addr+uint64(size) <= prog.Vaddr+prog.Filesz {
+				buf := make([]byte, size)
+				_, err := prog.ReadAt(buf, int64(addr-prog.Vaddr))
+				return buf, err
+			}
+		}
+		return nil, fmt.Errorf("0x%x is not loaded", addr)
+	}
+	decode := func(data []byte) uint64 {
+		if ptr == 8 {
+			return f.ByteOrder.Uint64(data)
+		}
+		return uint64(f.ByteOrder.Uint32(data))
+	}
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_DYNAMIC {
+			continue
+		}
+		dyn := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(dyn, 0); err != nil && err != io.EOF {
+			return err
+		}
+		for off := 0; off+2*ptr <= len(dyn); off += 2 * ptr {
+			if elf.DynTag(decode(dyn[off:])) != elf.DT_INIT_ARRAY {
+				continue
+			}
+			first, err := read(decode(dyn[off+ptr:]), ptr)
+			if err != nil {
+				return err
+			}
+			if decode(first) != init {
+				return fmt.Errorf("DT_INIT_ARRAY starts with 0x%x, not 0x%x", decode(first), init)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no DT_INIT_ARRAY")
+}
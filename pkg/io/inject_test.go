@@ -0,0 +1,109 @@
+package bcio
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// buildProgram compiles a small C program, or skips the test if there is no
+// C compiler.
+func buildProgram(t *testing.T, flags ...string) string {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.c")
+	if err := os.WriteFile(src, []byte("int main(void) { return 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "main")
+	args := append(append([]string{}, flags...), "-o", out, src)
+	if msg, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+		t.Skipf("cannot build a test program: %v\n%s", err, msg)
+	}
+	return out
+}
+
+func TestInjectLibrary(t *testing.T) {
+	// exit(42) on x86-64, so that running the result shows that the stub ran.
+	stub := []byte{
+		0xbf, 0x2a, 0x00, 0x00, 0x00, // mov edi, 42
+		0xb8, 0x3c, 0x00, 0x00, 0x00, // mov eax, 60
+		0x0f, 0x05, // syscall
+	}
+	const lib = "libm.so.6"
+
+	for _, flags := range [][]string{{"-pie", "-fPIE"}, {"-no-pie"}} {
+		filename := buildProgram(t, flags...)
+		b := ReadElf(filename)
+		if err := b.CanInject(lib, true); err != nil {
+			t.Fatalf("%v: %v", flags, err)
+		}
+		addr, err := b.NextAllocation(16, elf.PF_R|elf.PF_X)
+		if err != nil {
+			t.Fatalf("%v: %v", flags, err)
+		}
+		if got, err := b.Allocate(uint64(len(stub)), 16, elf.PF_R|elf.PF_X); err != nil || got != addr {
+			t.Fatalf("%v: Allocate = 0x%x, %v, want 0x%x", flags, got, err, addr)
+		}
+		b.WriteMemory(addr, stub)
+		if err := b.AddNeeded(lib); err != nil {
+			t.Fatalf("%v: %v", flags, err)
+		}
+		if err := b.AddInitFunction(addr); err != nil {
+			t.Fatalf("%v: %v", flags, err)
+		}
+		if err := b.Commit(); err != nil {
+			t.Fatalf("%v: %v", flags, err)
+		}
+
+		if err := CheckInjection(filename, lib, addr); err != nil {
+			t.Errorf("%v: %v", flags, err)
+		}
+		f, err := elf.Open(filename)
+		if err != nil {
+			t.Fatalf("%v: %v", flags, err)
+		}
+		var lastLoad uint64
+		for _, prog := range f.Progs {
+			if prog.Type != elf.PT_LOAD {
+				continue
+			}
+			if prog.Flags&elf.PF_W != 0 && prog.Flags&elf.PF_X != 0 {
+				t.Errorf("%v: writable and executable segment at 0x%x", flags, prog.Vaddr)
+			}
+			if prog.Vaddr < lastLoad {
+				t.Errorf("%v: segment at 0x%x is not sorted", flags, prog.Vaddr)
+			}
+			lastLoad = prog.Vaddr
+		}
+		f.Close()
+
+		if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" || f.Machine != elf.EM_X86_64 {
+			continue
+		}
+		err = exec.Command(filename).Run()
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 42 {
+			t.Errorf("%v: the stub did not run: %v", flags, err)
+		}
+	}
+}
+
+func TestInjectLibraryTwice(t *testing.T) {
+	filename := buildProgram(t)
+	b := ReadElf(filename)
+	if err := b.AddNeeded("libm.so.6"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CanInject("libm.so.6", false); err == nil {
+		t.Error("CanInject accepts a library that is already needed")
+	}
+	if _, err := b.Allocate(1, 1, elf.PF_W|elf.PF_X); err == nil {
+		t.Error("Allocate returns writable and executable memory")
+	}
+}
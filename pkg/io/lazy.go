@@ -0,0 +1,58 @@
+package bcio
+
+import "fmt"
+
+// lazyPages tracks the pages of a segment that are read. The memory of a
+// process can be large, e.g. its heap and stack, so its segments are read a
+// page at a time when they are first accessed.
+type lazyPages struct {
+	loaded map[uint64]bool
+	// read fills buf with the memory at addr.
+	read func(addr uint64, buf []byte) error
+}
+
+// load reads the pages of m that hold [off, off+size) and are not read yet.
+// Patched bytes are kept. Pages that cannot be read stay unread, so the
+// error is returned instead of zeros.
+func (m memSegment) load(off int64, size int64) error {
+	p := m.lazy
+	if p == nil || size <= 0 || off >= int64(len(m.Data)) {
+		return nil
+	}
+	if off < 0 {
+		size += off
+		off = 0
+	}
+	end := off + size
+	if end > int64(len(m.Data)) {
+		end = int64(len(m.Data))
+	}
+	last := uint64(end-1) / pageSize
+	for page := uint64(off) / pageSize; page <= last; {
+		if p.loaded[page] {
+			page++
+			continue
+		}
+		// Adjacent pages are read at once.
+		next := page + 1
+		for next <= last && !p.loaded[next] {
+			next++
+		}
+		start, stop := page*pageSize, next*pageSize
+		if stop > uint64(len(m.Data)) {
+			stop = uint64(len(m.Data))
+		}
+		if err := p.read(m.Vaddr+start, m.Data[start:stop]); err != nil {
+			return fmt.Errorf("cannot read 0x%x-0x%x: %v", m.Vaddr+start, m.Vaddr+stop, err)
+		}
+		for idx, val := range m.changes {
+			if uint64(idx) >= start && uint64(idx) < stop {
+				m.Data[idx] = val
+			}
+		}
+		for ; page < next; page++ {
+			p.loaded[page] = true
+		}
+	}
+	return nil
+}
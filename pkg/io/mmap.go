@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package bcio
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the bytes of f at [offset, offset+size), or fewer if the file
+// ends before. The mapping is private, so writing to it copies the pages
+// instead of changing the file, and Save writes the changes.
+func mapFile(f *os.File, offset int64, size uint64) ([]byte, error) {
+	size, err := clipToFile(f, offset, size)
+	if err != nil || size == 0 {
+		return []byte{}, err
+	}
+	// Offsets of mappings are aligned to pages of the system, which may be
+	// larger than the alignment of segments.
+	skip := offset % int64(os.Getpagesize())
+	data, err := syscall.Mmap(int(f.Fd()), offset-skip, int(int64(size)+skip),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	return data[skip:], nil
+}
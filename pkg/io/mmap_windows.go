@@ -0,0 +1,15 @@
+package bcio
+
+import "os"
+
+// mapFile reads the bytes of f at [offset, offset+size), or fewer if the file
+// ends before.
+func mapFile(f *os.File, offset int64, size uint64) ([]byte, error) {
+	size, err := clipToFile(f, offset, size)
+	if err != nil || size == 0 {
+		return []byte{}, err
+	}
+	buf := make([]byte, size)
+	_, err = f.ReadAt(buf, offset)
+	return buf, err
+}
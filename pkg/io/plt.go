@@ -0,0 +1,293 @@
+package bcio
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// Import is an imported symbol that is resolved into a GOT slot.
+type Import struct {
+	Name string
+	Slot uint64
+	// Reloc is the address of the relocation entry that fills the slot, and
+	// RelocType is its type, e.g. R_X86_64_JMP_SLOT.
+	Reloc     uint64
+	RelocType uint32
+	Rela      bool
+	// Plt is the address of the PLT stub that jumps through the slot, or 0.
+	Plt     uint64
+	PltSize uint64
+}
+
+// readRelocations parses a SHT_RELA or SHT_REL section.
+func readRelocations(_elf *elf.File, section *elf.Section) []Relocation {
+	data, err := section.Data()
+	if err != nil {
+		return nil
+	}
+	order := _elf.ByteOrder
+	relocs := make([]Relocation, 0)
+
+	switch {
+	case _elf.Class == elf.ELFCLASS64 && section.Type == elf.SHT_RELA:
+		for off := 0; off+24 <= len(data); off += 24 {
+			info := order.Uint64(data[off+8:])
+			relocs = append(relocs, Relocation{
+				Addr:   section.Addr + uint64(off),
+				Offset: order.Uint64(data[off:]),
+				Type:   uint32(info),
+				Sym:    uint32(info >> 32),
+				Addend: int64(order.Uint64(data[off+16:])),
+				Rela:   true,
+			})
+		}
+	case _elf.Class == elf.ELFCLASS64 && section.Type == elf.SHT_REL:
+		for off := 0; off+16 <= len(data); off += 16 {
+			info := order.Uint64(data[off+8:])
+			relocs = append(relocs, Relocation{
+				Addr:   section.Addr + uint64(off),
+				Offset: order.Uint64(data[off:]),
+				Type:   uint32(info),
+				Sym:    uint32(info >> 32),
+			})
+		}
+	case _elf.Class == elf.ELFCLASS32 && section.Type == elf.SHT_RELA:
+		for off := 0; off+12 <= len(data); off += 12 {
+			info := order.Uint32(data[off+4:])
+			relocs = append(relocs, Relocation{
+				Addr:   section.Addr + uint64(off),
+				Offset: uint64(order.Uint32(data[off:])),
+				Type:   info & 0xff,
+				Sym:    info >> 8,
+				Addend: int64(int32(order.Uint32(data[off+8:]))),
+				Rela:   true,
+			})
+		}
+	case _elf.Class == elf.ELFCLASS32 && section.Type == elf.SHT_REL:
+		for off := 0; off+8 <= len(data); off += 8 {
+			info := order.Uint32(data[off+4:])
+			relocs = append(relocs, Relocation{
+				Addr:   section.Addr + uint64(off),
+				Offset: uint64(order.Uint32(data[off:])),
+				Type:   info & 0xff,
+				Sym:    info >> 8,
+			})
+		}
+	}
+	return relocs
+}
+
+// loadGotImports maps GOT slots to imported symbols, using the relocations
+// that refer to .dynsym.
+func loadGotImports(_elf *elf.File, dynsyms []elf.Symbol) map[uint64]*Import {
+	got := make(map[uint64]*Import)
+	for _, section := range _elf.Sections {
+		if section.Type != elf.SHT_RELA && section.Type != elf.SHT_REL {
+			continue
+		}
+		if linked := int(section.Link); linked <= 0 || linked >= len(_elf.Sections) ||
+			_elf.Sections[linked].Type != elf.SHT_DYNSYM {
+			continue
+		}
+		for _, reloc := range readRelocations(_elf, section) {
+			// Symbol index 0 is the null symbol, which DynamicSymbols skips.
+			if reloc.Sym == 0 || int(reloc.Sym) > len(dynsyms) {
+				continue
+			}
+			if name := dynsyms[reloc.Sym-1].Name; name != "" {
+				got[reloc.Offset] = &Import{
+					Name:      name,
+					Slot:      reloc.Offset,
+					Reloc:     reloc.Addr,
+					RelocType: reloc.Type,
+					Rela:      section.Type == elf.SHT_RELA,
+				}
+			}
+		}
+	}
+	return got
+}
+
+func signExtend(val uint64, bits uint) int64 {
+	shift := 64 - bits
+	return int64(val<<shift) >> shift
+}
+
+// pltSlot finds the GOT slot that the PLT stub at data[off:] jumps through.
+func pltSlot(machine elf.Machine, data []byte, off int, addr uint64, gotBase uint64) (uint64, bool) {
+	switch machine {
+	case elf.EM_X86_64:
+		// jmp qword ptr [rip + disp32]
+		if off+6 <= len(data) && data[off] == 0xff && data[off+1] == 0x25 {
+			disp := int32(binary.LittleEndian.Uint32(data[off+2:]))
+			return addr + 6 + uint64(disp), true
+		}
+	case elf.EM_386:
+		if off+6 <= len(data) && data[off] == 0xff && data[off+1] == 0x25 {
+			// jmp dword ptr [abs32]
+			return uint64(binary.LittleEndian.Uint32(data[off+2:])), true
+		}
+		if off+6 <= len(data) && data[off] == 0xff && data[off+1] == 0xa3 {
+			// jmp dword ptr [ebx + disp32], where ebx holds the GOT.
+			disp := int32(binary.LittleEndian.Uint32(data[off+2:]))
+			return gotBase + uint64(disp), true
+		}
+	case elf.EM_AARCH64:
+		// adrp x16, page; ldr x17, [x16, #imm]
+		if off+8 > len(data) {
+			return 0, false
+		}
+		adrp := binary.LittleEndian.Uint32(data[off:])
+		ldr := binary.LittleEndian.Uint32(data[off+4:])
+		if adrp&0x9f00001f != 0x90000010 || ldr&0xffc003ff != 0xf9400211 {
+			return 0, false
+		}
+		imm := uint64(adrp>>29&0x3) | uint64(adrp>>5&0x7ffff)<<2
+		page := addr&^0xfff + uint64(signExtend(imm<<12, 33))
+		return page + uint64(ldr>>10&0xfff)*8, true
+	}
+	return 0, false
+}
+
+// loadPltSymbols names PLT stubs after the imports they jump to, such as
+// "printf@plt", and records the stubs in the imports.
+func loadPltSymbols(_elf *elf.File, got map[uint64]*Import) []Symbol {
+	var gotBase uint64
+	if section := _elf.Section(".got.plt"); section != nil {
+		gotBase = section.Addr
+	} else if section := _elf.Section(".got"); section != nil {
+		gotBase = section.Addr
+	}
+
+	symbols := make([]Symbol, 0)
+	for _, section := range _elf.Sections {
+		if !strings.HasPrefix(section.Name, ".plt") || section.Type != elf.SHT_PROGBITS {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+		// sh_entsize of .plt is not reliable (e.g. 4 on i386), so use the
+		// stub sizes that linkers emit.
+		entsize := uint64(16)
+		if section.Name == ".plt.got" {
+			entsize = 8
+		}
+
+		named := make(map[uint64]bool)
+		step := 1
+		if _elf.Machine == elf.EM_AARCH64 {
+			step = 4
+		}
+		for off := 0; off < len(data); off += step {
+			addr := section.Addr + uint64(off)
+			slot, ok := pltSlot(_elf.Machine, data, off, addr, gotBase)
+			if !ok {
+				continue
+			}
+			imp, exists := got[slot]
+			stub := section.Addr + uint64(off)/entsize*entsize
+			if !exists || named[stub] {
+				continue
+			}
+			named[stub] = true
+			// .plt.sec stubs are called instead of the ones in .plt.
+			if imp.Plt == 0 || section.Name == ".plt.sec" {
+				imp.Plt = stub
+				imp.PltSize = entsize
+			}
+			symbols = append(symbols, Symbol{
+				Name: imp.Name + "@plt",
+				Addr: stub,
+				Size: entsize,
+				Kind: ImportSymbol,
+			})
+		}
+	}
+	return symbols
+}
+
+// loadDynamicSymbols reads .dynsym, and names PLT stubs and GOT slots of
+// imported functions.
+func loadDynamicSymbols(_elf *elf.File) ([]Symbol, []Import) {
+	dynsyms, err := _elf.DynamicSymbols()
+	if err != nil {
+		return nil, nil
+	}
+
+	symbols := make([]Symbol, 0)
+	for _, symbol := range dynsyms {
+		infoType := elf.ST_TYPE(symbol.Info)
+		if symbol.Section == elf.SHN_UNDEF || symbol.Value == 0 {
+			continue
+		}
+		if infoType == elf.STT_FUNC || infoType == elf.STT_OBJECT {
+			kind := FuncSymbol
+			if infoType == elf.STT_OBJECT {
+				kind = ObjectSymbol
+			}
+			symbols = append(symbols, Symbol{
+				Name: symbol.Name,
+				Addr: symbol.Value,
+				Size: symbol.Size,
+				Kind: kind,
+			})
+		}
+	}
+
+	slotSize := uint64(8)
+	if _elf.Class == elf.ELFCLASS32 {
+		slotSize = 4
+	}
+	got := loadGotImports(_elf, dynsyms)
+	for slot, imp := range got {
+		symbols = append(symbols, Symbol{
+			Name: imp.Name + "@got",
+			Addr: slot,
+			Size: slotSize,
+			Kind: ImportSymbol,
+		})
+	}
+	symbols = append(symbols, loadPltSymbols(_elf, got)...)
+
+	imports := make([]Import, 0, len(got))
+	for _, imp := range got {
+		imports = append(imports, *imp)
+	}
+	sort.Slice(imports, func(i, j int) bool {
+		return imports[i].Name < imports[j].Name ||
+			(imports[i].Name == imports[j].Name && imports[i].Slot < imports[j].Slot)
+	})
+	return symbols, imports
+}
+
+// EncodeRelocation returns the bytes of the relocation entry of imp with a
+// new type, symbol and addend. The addend is dropped for SHT_REL entries.
+func (b *Binary) EncodeRelocation(imp Import, typ uint32, sym uint32, addend int64) []byte {
+	return b.encodeRelocation(Relocation{Offset: imp.Slot, Type: typ, Sym: sym, Addend: addend}, imp.Rela)
+}
+
+func (b *Binary) encodeRelocation(reloc Relocation, rela bool) []byte {
+	size := 4
+	info := uint64(reloc.Sym)<<8 | uint64(reloc.Type&0xff)
+	if b.tables.class == elf.ELFCLASS64 {
+		size = 8
+		info = uint64(reloc.Sym)<<32 | uint64(reloc.Type)
+	}
+	data := append(b.tables.encode(reloc.Offset, size), b.tables.encode(info, size)...)
+	if rela {
+		data = append(data, b.tables.encode(uint64(reloc.Addend), size)...)
+	}
+	return data
+}
+
+// EncodeAddress returns the bytes of an address as stored in a GOT slot.
+func (b *Binary) EncodeAddress(addr uint64) []byte {
+	if b.tables.class == elf.ELFCLASS64 {
+		return b.tables.encode(addr, 8)
+	}
+	return b.tables.encode(addr, 4)
+}
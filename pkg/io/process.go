@@ -0,0 +1,248 @@
+//go:build linux
+// +build linux
+
+package bcio
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procMapping is a line of /proc/<pid>/maps.
+type procMapping struct {
+	MappedFile
+	perm string
+}
+
+func readProcMaps(pid int) ([]procMapping, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mappings := make([]procMapping, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g. "55d0c4a00000-55d0c4a01000 r-xp 00001000 08:01 1234 /usr/bin/cat"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		start, err1 := strconv.ParseUint(bounds[0], 16, 64)
+		end, err2 := strconv.ParseUint(bounds[1], 16, 64)
+		offset, err3 := strconv.ParseUint(fields[2], 16, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		m := procMapping{MappedFile{Start: start, End: end, Offset: offset}, fields[1]}
+		if len(fields) > 5 {
+			m.Path = strings.Join(fields[5:], " ")
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, scanner.Err()
+}
+
+// readTasks returns the threads of a process.
+func readTasks(pid int) ([]int, error) {
+	dir, err := os.Open(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(names))
+	for _, name := range names {
+		if tid, err := strconv.Atoi(name); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
+
+// stopThreads attaches to every thread of the process and waits until they
+// stop. The attached threads are added to stopped, also on errors.
+func (b *Binary) stopThreads(stopped map[int]bool) error {
+	// A running thread may start new ones, so the threads are read until
+	// every one is stopped.
+	for {
+		tids, err := readTasks(b.pid)
+		if err != nil {
+			return err
+		}
+		added := false
+		for _, tid := range tids {
+			if stopped[tid] {
+				continue
+			}
+			if err := syscall.PtraceAttach(tid); err != nil {
+				if err == syscall.ESRCH {
+					// The thread exited.
+					continue
+				}
+				return fmt.Errorf("cannot attach to %d: %v", tid, err)
+			}
+			stopped[tid] = true
+			added = true
+			var status syscall.WaitStatus
+			if _, err := syscall.Wait4(tid, &status, syscall.WALL, nil); err != nil {
+				return err
+			}
+		}
+		if !added {
+			return nil
+		}
+	}
+}
+
+// whileStopped attaches to every thread of the process, calls fn while they
+// are stopped, and detaches.
+func (b *Binary) whileStopped(fn func() error) error {
+	// Every ptrace request must come from the thread that attached.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	stopped := make(map[int]bool)
+	err := b.stopThreads(stopped)
+	if err == nil {
+		err = fn()
+	}
+	for tid := range stopped {
+		if detachErr := syscall.PtraceDetach(tid); err == nil && detachErr != syscall.ESRCH {
+			err = detachErr
+		}
+	}
+	return err
+}
+
+// readProcMemory maps the readable mappings of the process. They are read
+// from /proc/<pid>/mem when they are accessed, so that large mappings do not
+// take memory. The file offset of a segment is its address, so Save writes
+// patches back to the process.
+func (b *Binary) readProcMemory(mem *os.File, mappings []procMapping) []memSegment {
+	read := func(addr uint64, buf []byte) error {
+		return b.whileStopped(func() error {
+			mem, err := os.Open(b.filename)
+			if err != nil {
+				return err
+			}
+			defer mem.Close()
+			_, err = mem.ReadAt(buf, int64(addr))
+			return err
+		})
+	}
+
+	memory := make([]memSegment, 0, len(mappings))
+	probe := make([]byte, 1)
+	for _, m := range mappings {
+		if !strings.HasPrefix(m.perm, "r") || m.Start > 1<<63-1 || m.End <= m.Start {
+			continue
+		}
+		if n, _ := mem.ReadAt(probe, int64(m.Start)); n == 0 {
+			// e.g. [vvar], which cannot be read through /proc/<pid>/mem.
+			continue
+		}
+		// Anonymous memory takes no space until its pages are written.
+		buf, err := syscall.Mmap(-1, 0, int(m.End-m.Start), syscall.PROT_READ|syscall.PROT_WRITE,
+			syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS|syscall.MAP_NORESERVE)
+		if err != nil {
+			log.Printf("Failed to map 0x%x-0x%x: %v", m.Start, m.End, err)
+			continue
+		}
+		memory = append(memory, memSegment{
+			Vaddr:   m.Start,
+			Offset:  int64(m.Start),
+			Memsz:   m.End - m.Start,
+			Data:    buf,
+			changes: make(map[int]byte),
+			lazy:    &lazyPages{loaded: make(map[uint64]bool), read: read},
+		})
+	}
+	return memory
+}
+
+// ReadProcess loads the memory of a running process. Symbols and code
+// sections come from the ELF files that it maps, and Save writes patches to
+// its memory. The process is stopped with ptrace while it is read and while
+// patches are written.
+func ReadProcess(pid int) (*Binary, error) {
+	mappings, err := readProcMaps(pid)
+	if err != nil {
+		return nil, err
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return nil, err
+	}
+	filename := fmt.Sprintf("/proc/%d/mem", pid)
+	b := &Binary{
+		filename:    filename,
+		pid:         pid,
+		Symbol2Addr: make(map[string]uint64),
+		Addr2Symbol: make(map[uint64]string),
+		Symbols:     make([]Symbol, 0),
+	}
+
+	err = b.whileStopped(func() error {
+		mem, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer mem.Close()
+		b.memory = b.readProcMemory(mem, mappings)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]MappedFile, 0, len(mappings))
+	for _, m := range mappings {
+		if strings.HasPrefix(m.Path, "/") {
+			files = append(files, m.MappedFile)
+		}
+	}
+	// The executable is added first, so its names win.
+	paths := []string{exe}
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	opened := make(map[string]bool)
+	for _, path := range paths {
+		if opened[path] {
+			continue
+		}
+		opened[path] = true
+		image, err := openImage(path, "", files)
+		if err != nil {
+			log.Printf("Failed to load %s: %v", path, err)
+			continue
+		}
+		b.addImage(image)
+		if path == exe {
+			b.tables = headerTables{class: image.elf.Class, order: image.elf.ByteOrder}
+			b.Entry = image.elf.Entry + image.bias
+			b.MachineType = image.elf.Machine.String()
+		}
+		image.file.Close()
+	}
+	if b.MachineType == "" {
+		return nil, fmt.Errorf("cannot load the executable of %d: %s", pid, exe)
+	}
+	sortCodeSections(b.CodeSections)
+	return b, nil
+}
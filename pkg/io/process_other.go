@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package bcio
+
+import "errors"
+
+var errNoProcess = errors.New("live processes are only supported on Linux")
+
+func (b *Binary) whileStopped(fn func() error) error {
+	return errNoProcess
+}
+
+// ReadProcess loads the memory of a running process.
+func ReadProcess(pid int) (*Binary, error) {
+	return nil, errNoProcess
+}
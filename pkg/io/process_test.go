@@ -0,0 +1,109 @@
+//go:build linux
+// +build linux
+
+package bcio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The program prints the address of value and exits with it once it
+// changes. A second thread runs too, so that every thread must be stopped.
+const processSource = `#include <pthread.h>
+#include <stdio.h>
+#include <unistd.h>
+
+volatile int value = 1;
+
+static void *spin(void *arg) {
+	for (;;)
+		usleep(1000);
+	return arg;
+}
+
+int main(void) {
+	pthread_t thread;
+	pthread_create(&thread, NULL, spin, NULL);
+	printf("%p\n", (void *)&value);
+	fflush(stdout);
+	while (value == 1)
+		usleep(1000);
+	return value;
+}
+`
+
+func TestReadProcess(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.c")
+	if err := os.WriteFile(src, []byte(processSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "main")
+	if msg, err := exec.Command(cc, "-pthread", "-o", filename, src).CombinedOutput(); err != nil {
+		t.Skipf("cannot build a test program: %v\n%s", err, msg)
+	}
+
+	cmd := exec.Command(filename)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(line), "0x"), 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ReadProcess(cmd.Process.Pid)
+	if err != nil {
+		t.Skipf("cannot trace the process: %v", err)
+	}
+	if got := b.ReadMemory(addr, 4); len(got) != 4 || binary.LittleEndian.Uint32(got) != 1 {
+		t.Fatalf("ReadMemory(0x%x) = %v, want 1", addr, got)
+	}
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, 42)
+	if n := b.WriteMemory(addr, buf); n != 4 {
+		t.Fatalf("WriteMemory = %d, want 4", n)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 42 {
+		t.Errorf("the process did not see the patch: %v", err)
+	}
+
+	// Pages that are not read yet cannot be read after the process exits,
+	// and they must not read as zeros.
+	for _, segment := range b.Segments() {
+		if segment.Vaddr&^(pageSize-1) == addr&^(pageSize-1) {
+			continue
+		}
+		if got := b.ReadMemory(segment.Vaddr, 1); got != nil {
+			t.Errorf("ReadMemory(0x%x) = %v after the process exited, want nil", segment.Vaddr, got)
+		}
+		if b.ReadError() == nil {
+			t.Errorf("ReadError() = nil after reading 0x%x of an exited process", segment.Vaddr)
+		}
+		break
+	}
+}
@@ -0,0 +1,283 @@
+package bcio
+
+import (
+	"debug/elf"
+	"fmt"
+	"sort"
+)
+
+// Tags of DT_RELR, which debug/elf of older Go versions does not define.
+const (
+	dtRelrSz elf.DynTag = 35
+	dtRelr   elf.DynTag = 36
+)
+
+// DF_1_NOW of DT_FLAGS_1, which debug/elf of older Go versions does not
+// define either.
+const df1Now = 0x1
+
+// Relocation is a relocation entry. The loader writes Size bytes at Offset.
+type Relocation struct {
+	Addr   uint64 // Address of the entry itself, or 0 for DT_RELR.
+	Offset uint64
+	Size   uint64
+	Type   uint32
+	Sym    uint32
+	Addend int64
+	Rela   bool
+	// Relr means that the relocation is packed in DT_RELR, and adds the load
+	// base to the address stored at Offset.
+	Relr bool
+}
+
+// relocCache holds the dynamic relocations, which are looked up on every
+// patch and preview.
+type relocCache struct {
+	relocs []Relocation
+	// tables are the memory ranges that the relocations are read from. A
+	// write into them, e.g. a removed relocation or its undo, drops the cache.
+	tables [][2]uint64
+}
+
+func (c *relocCache) overlaps(addr uint64, size uint64) bool {
+	for _, t := range c.tables {
+		if addr < t[1] && addr+size > t[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidateRelocs drops the cached relocations after the relocation tables
+// or the dynamic section change.
+func (b *Binary) invalidateRelocs() {
+	b.relocCache = nil
+}
+
+// Patch is a change of memory bytes.
+type Patch struct {
+	Addr uint64
+	Data []byte
+}
+
+// relocSize returns the number of bytes that a relocation type writes. Type
+// 0 is R_*_NONE on every architecture, which writes nothing.
+func (b *Binary) relocSize(typ uint32) uint64 {
+	if typ == 0 {
+		return 0
+	}
+	switch b.MachineType {
+	case "EM_X86_64":
+		switch elf.R_X86_64(typ) {
+		case elf.R_X86_64_32, elf.R_X86_64_32S, elf.R_X86_64_PC32:
+			return 4
+		}
+	case "EM_AARCH64":
+		switch elf.R_AARCH64(typ) {
+		case elf.R_AARCH64_ABS32, elf.R_AARCH64_PREL32:
+			return 4
+		}
+	}
+	return uint64(b.ptrSize())
+}
+
+// readRelr unpacks DT_RELR. An even entry is an address, and an odd entry is
+// a bitmap of the words that follow the last address.
+func (b *Binary) readRelr(entries []DynEntry) []Relocation {
+	addr, ok := dynValue(entries, dtRelr)
+	size, _ := dynValue(entries, dtRelrSz)
+	if !ok {
+		return nil
+	}
+	relative, _ := b.relativeRelocType()
+	ptr := uint64(b.ptrSize())
+	data := b.ReadMemory(addr, size)
+	relocs := make([]Relocation, 0)
+	add := func(where uint64) {
+		relocs = append(relocs, Relocation{Offset: where, Type: relative, Relr: true})
+	}
+
+	var where uint64
+	for off := uint64(0); off+ptr <= uint64(len(data)); off += ptr {
+		entry := b.tables.decode(data[off : off+ptr])
+		if entry&1 == 0 {
+			add(entry)
+			where = entry + ptr
+			continue
+		}
+		bits := ptr*8 - 1
+		for i := uint64(0); i < bits; i++ {
+			if entry>>(i+1)&1 != 0 {
+				add(where + i*ptr)
+			}
+		}
+		where += bits * ptr
+	}
+	return relocs
+}
+
+// DynamicRelocations returns the relocations that the loader applies, sorted
+// by their targets. They are read once, and read again after the tables
+// change.
+func (b *Binary) DynamicRelocations() []Relocation {
+	if b.relocCache == nil {
+		b.relocCache = b.readDynamicRelocations()
+	}
+	return b.relocCache.relocs
+}
+
+func (b *Binary) readDynamicRelocations() *relocCache {
+	cache := &relocCache{}
+	phdrIdx, err := b.dynamicHeader()
+	if err != nil {
+		return cache
+	}
+	dynAddr := b.headerValue(ProgramHeader, phdrIdx, "p_vaddr")
+	cache.tables = append(cache.tables, [2]uint64{dynAddr, dynAddr + b.headerValue(ProgramHeader, phdrIdx, "p_filesz")})
+	entries, err := b.readDynamic()
+	if err != nil {
+		return cache
+	}
+	addTable := func(addrTag elf.DynTag, sizeTag elf.DynTag) {
+		addr, ok := dynValue(entries, addrTag)
+		size, _ := dynValue(entries, sizeTag)
+		if ok {
+			cache.tables = append(cache.tables, [2]uint64{addr, addr + size})
+		}
+	}
+
+	table := b.findRelocTable(entries)
+	relocs, addr := b.readRelocTable(entries, table)
+	size, _ := dynValue(entries, table.sizeTag)
+	addTable(table.addrTag, table.sizeTag)
+	// DT_JMPREL may be a part of the main table.
+	if jmprel, ok := dynValue(entries, elf.DT_JMPREL); ok && (jmprel < addr || jmprel >= addr+size) {
+		pltSize, _ := dynValue(entries, elf.DT_PLTRELSZ)
+		rela := table.rela
+		if pltRel, ok := dynValue(entries, elf.DT_PLTREL); ok {
+			rela = elf.DynTag(pltRel) == elf.DT_RELA
+		}
+		relocs = append(relocs, b.readRelocs(jmprel, pltSize, rela)...)
+		addTable(elf.DT_JMPREL, elf.DT_PLTRELSZ)
+	}
+	relocs = append(relocs, b.readRelr(entries)...)
+	addTable(dtRelr, dtRelrSz)
+
+	for i := range relocs {
+		relocs[i].Size = b.relocSize(relocs[i].Type)
+	}
+	sort.SliceStable(relocs, func(i, j int) bool { return relocs[i].Offset < relocs[j].Offset })
+	cache.relocs = relocs
+	return cache
+}
+
+// maxRelocSize is the largest number of bytes that a relocation writes.
+const maxRelocSize = 8
+
+// RelocationsAt returns the relocations that write into [addr, addr+size).
+func (b *Binary) RelocationsAt(addr uint64, size uint64) []Relocation {
+	relocs := b.DynamicRelocations()
+	found := make([]Relocation, 0)
+	// Relocations are sorted by their targets, and write at most 8 bytes.
+	idx := sort.Search(len(relocs), func(i int) bool { return relocs[i].Offset+maxRelocSize > addr })
+	for ; idx < len(relocs) && relocs[idx].Offset < addr+size; idx++ {
+		if reloc := relocs[idx]; reloc.Offset+reloc.Size > addr {
+			found = append(found, reloc)
+		}
+	}
+	return found
+}
+
+// bindsNow returns true if the loader resolves every symbol at startup, so
+// that DT_JMPREL is processed like the other relocations.
+func bindsNow(entries []DynEntry) bool {
+	if _, ok := dynValue(entries, elf.DT_BIND_NOW); ok {
+		return true
+	}
+	flags, _ := dynValue(entries, elf.DT_FLAGS)
+	flags1, _ := dynValue(entries, elf.DT_FLAGS_1)
+	return elf.DynFlag(flags)&elf.DF_BIND_NOW != 0 || flags1&df1Now != 0
+}
+
+// dynValuePatch returns the patch that changes the value of a dynamic tag.
+func (b *Binary) dynValuePatch(entries []DynEntry, tag elf.DynTag, value uint64) (Patch, error) {
+	phdrIdx, err := b.dynamicHeader()
+	if err != nil {
+		return Patch{}, err
+	}
+	entSize := uint64(b.dynEntrySize())
+	base := b.headerValue(ProgramHeader, phdrIdx, "p_vaddr")
+	for i, e := range entries {
+		if e.Tag == tag {
+			addr := base + uint64(i)*entSize + entSize/2
+			return Patch{addr, b.tables.encode(value, int(entSize/2))}, nil
+		}
+	}
+	return Patch{}, fmt.Errorf("no %v", tag)
+}
+
+// RemoveRelocation returns the patches that turn a relocation into
+// R_*_NONE, so that the loader keeps the bytes at its target.
+func (b *Binary) RemoveRelocation(reloc Relocation) ([]Patch, error) {
+	if reloc.Relr {
+		return nil, fmt.Errorf("relocations in DT_RELR cannot be removed")
+	}
+	entries, err := b.readDynamic()
+	if err != nil {
+		return nil, err
+	}
+	// Under lazy binding, the loader expects only jump slot relocations in
+	// DT_JMPREL, and rejects R_*_NONE.
+	jmprel, hasJmprel := dynValue(entries, elf.DT_JMPREL)
+	pltSize, _ := dynValue(entries, elf.DT_PLTRELSZ)
+	if hasJmprel && reloc.Addr >= jmprel && reloc.Addr < jmprel+pltSize && !bindsNow(entries) {
+		return nil, fmt.Errorf("relocations in DT_JMPREL cannot be removed under lazy binding; hook the PLT stub instead")
+	}
+	table := b.findRelocTable(entries)
+	tableAddr, _ := dynValue(entries, table.addrTag)
+	entSize := uint64(b.relocEntSize(reloc.Rela))
+	countTag := elf.DT_RELCOUNT
+	if table.rela {
+		countTag = elf.DT_RELACOUNT
+	}
+
+	patches := make([]Patch, 0, 3)
+	count, hasCount := dynValue(entries, countTag)
+	if hasCount && count > 0 && reloc.Rela == table.rela &&
+		reloc.Addr >= tableAddr && reloc.Addr < tableAddr+count*entSize {
+		// The loader applies the first DT_RELACOUNT entries as relative ones
+		// without looking at their types, so the last of them takes the place
+		// of the removed one.
+		last := tableAddr + (count-1)*entSize
+		moved := append([]byte{}, b.ReadMemory(last, entSize)...)
+		patches = append(patches, Patch{reloc.Addr, moved})
+		countPatch, err := b.dynValuePatch(entries, countTag, count-1)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, countPatch)
+		reloc.Addr = last
+	}
+	return append(patches, Patch{reloc.Addr, b.encodeRelocation(Relocation{}, reloc.Rela)}), nil
+}
+
+// AdjustRelocation returns the patches that make a relative relocation
+// relocate the patched address at its target instead of the old one. It
+// returns no patches for SHT_REL and DT_RELR, which already add the base to
+// the bytes at the target.
+func (b *Binary) AdjustRelocation(reloc Relocation) ([]Patch, error) {
+	relative, ok := b.relativeRelocType()
+	if !ok || reloc.Type != relative {
+		return nil, fmt.Errorf("only relative relocations can be adjusted")
+	}
+	if !reloc.Rela || reloc.Relr {
+		return nil, nil
+	}
+	ptr := b.ptrSize()
+	data := b.ReadMemory(reloc.Offset, uint64(ptr))
+	if len(data) != ptr {
+		return nil, fmt.Errorf("0x%x is not loaded", reloc.Offset)
+	}
+	addend := b.tables.encode(b.tables.decode(data), ptr)
+	return []Patch{{reloc.Addr + uint64(2*ptr), addend}}, nil
+}
@@ -0,0 +1,65 @@
+package bcio
+
+// Storage is where a project reads and patches memory: an ELF file, a core
+// file, the memory of a process, or any other source of code.
+type Storage interface {
+	// ReadMemory returns the bytes at addr. It returns fewer bytes, or nil,
+	// if the memory is not loaded.
+	ReadMemory(addr uint64, size uint64) []byte
+	// WriteMemory patches memory, and returns the number of bytes written in
+	// the first segment of addr, or -1 if addr cannot be written.
+	WriteMemory(addr uint64, data []byte) int
+	// Segments returns the loaded memory.
+	Segments() []Segment
+	SymbolList() []Symbol
+	LookupSymbol(name string) (uint64, bool)
+	SymbolAt(addr uint64) (string, bool)
+	// CodeRegions returns the memory that is disassembled, sorted by address.
+	CodeRegions() []CodeRegion
+	// FunctionHints returns known function starts besides symbols, e.g.
+	// from unwind tables.
+	FunctionHints() []uint64
+	EntryPoint() uint64
+	// Arch returns the machine type, e.g. "EM_X86_64".
+	Arch() string
+	// Commit writes the patches.
+	Commit() error
+}
+
+// SymbolList returns the symbols of the binary.
+func (b *Binary) SymbolList() []Symbol {
+	return b.Symbols
+}
+
+// LookupSymbol returns the address of a symbol.
+func (b *Binary) LookupSymbol(name string) (uint64, bool) {
+	addr, exists := b.Symbol2Addr[name]
+	return addr, exists
+}
+
+// SymbolAt returns the name of the symbol at addr.
+func (b *Binary) SymbolAt(addr uint64) (string, bool) {
+	name, exists := b.Addr2Symbol[addr]
+	return name, exists
+}
+
+// CodeRegions returns the executable sections.
+func (b *Binary) CodeRegions() []CodeRegion {
+	return b.CodeSections
+}
+
+// FunctionHints returns the functions of .eh_frame_hdr.
+func (b *Binary) FunctionHints() []uint64 {
+	return b.EHFunctions
+}
+
+// EntryPoint returns the entry of the binary, or the faulting instruction of
+// a core file.
+func (b *Binary) EntryPoint() uint64 {
+	return b.Entry
+}
+
+// Arch returns the machine type of the ELF header.
+func (b *Binary) Arch() string {
+	return b.MachineType
+}
@@ -0,0 +1,84 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+)
+
+// renameTarget returns the function that contains the cursor, or the cursor
+// address if it is not in a function.
+func (h *handler) renameTarget() (uint64, string) {
+	instr := h.lines[h.cursor].data.(*binch.Instruction)
+	if name, start, ok := h.project.FindFunction(instr.Address); ok {
+		return start, name
+	}
+	return instr.Address, instr.Name
+}
+
+// showInput opens a one-line input popup with text filled in.
+func (h *handler) showInput(g *gocui.Gui, name string, title string, text string) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView(name, maxX/2-40, maxY/2, maxX/2+40, maxY/2+2); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = title
+		v.Editable = true
+		fmt.Fprintf(v, "%s", text)
+		v.SetCursor(len(text), 0)
+		if _, err := setCurrentViewOnTop(g, name); err != nil {
+			return err
+		}
+	}
+	g.Cursor = true
+	return nil
+}
+
+func (h *handler) showRename(g *gocui.Gui, v *gocui.View) error {
+	addr, name := h.renameTarget()
+	return h.showInput(g, "rename", fmt.Sprintf("Rename 0x%x (empty: reset)", h.project.ToDisplay(addr)), name)
+}
+
+func (h *handler) applyRename(g *gocui.Gui, v *gocui.View) error {
+	addr, current := h.renameTarget()
+	name, _ := v.Line(0)
+	if name == current {
+		return h.exitRename(g, v)
+	}
+	if err := h.project.SetLabel(addr, name); err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	h.exitRename(g, v)
+	h.redraw()
+	return nil
+}
+
+func (h *handler) exitRename(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	return h.exitView(g, "rename")
+}
+
+func (h *handler) showComment(g *gocui.Gui, v *gocui.View) error {
+	instr := h.lines[h.cursor].data.(*binch.Instruction)
+	title := fmt.Sprintf("Comment at 0x%x (empty: remove)", h.project.ToDisplay(instr.Address))
+	return h.showInput(g, "comment", title, h.project.UserComment(instr.Address))
+}
+
+func (h *handler) applyComment(g *gocui.Gui, v *gocui.View) error {
+	instr := h.lines[h.cursor].data.(*binch.Instruction)
+	text, _ := v.Line(0)
+	if err := h.project.SetComment(instr.Address, text); err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	h.exitComment(g, v)
+	h.redraw()
+	return nil
+}
+
+func (h *handler) exitComment(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	return h.exitView(g, "comment")
+}
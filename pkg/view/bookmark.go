@@ -0,0 +1,100 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+)
+
+// markBack is the bookmark of the address before the last jump to a
+// bookmark, like the "'" mark of vim.
+const markBack = "'"
+
+func (h *handler) cursorAddr() uint64 {
+	return h.lines[h.cursor].data.(*binch.Instruction).Address
+}
+
+// bookmarkEditor waits for the name of a bookmark, and sets or jumps to it.
+func (h *handler) bookmarkEditor(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	name := string(ch)
+	isLetter := ch >= 'a' && ch <= 'z'
+	if !isLetter && !(ch == '\'' && !h.bookmarkSet) {
+		return
+	}
+	h.exitBookmark(h.gui, v)
+
+	if h.bookmarkSet {
+		if err := h.project.SetBookmark(name, h.cursorAddr()); err != nil {
+			h.popupEvents <- err.Error()
+		}
+		return
+	}
+	addr, exists := h.project.LookupBookmark(name)
+	if !exists {
+		h.popupEvents <- fmt.Sprintf("No Such Bookmark: %s", name)
+		return
+	}
+	if err := h.project.SetBookmark(markBack, h.cursorAddr()); err != nil {
+		h.popupEvents <- err.Error()
+	}
+	h.jumpTo(addr)
+}
+
+func (h *handler) showBookmarkPrompt(g *gocui.Gui, title string) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("bookmark", maxX/2-20, maxY/2, maxX/2+20, maxY/2+2); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = title
+		v.Editable = true
+		v.Editor = gocui.EditorFunc(h.bookmarkEditor)
+		if _, err := setCurrentViewOnTop(g, "bookmark"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *handler) showSetBookmark(g *gocui.Gui, v *gocui.View) error {
+	h.bookmarkSet = true
+	return h.showBookmarkPrompt(g, "Set bookmark (a-z)")
+}
+
+func (h *handler) showJumpBookmark(g *gocui.Gui, v *gocui.View) error {
+	h.bookmarkSet = false
+	return h.showBookmarkPrompt(g, "Go to bookmark (a-z, ')")
+}
+
+func (h *handler) exitBookmark(g *gocui.Gui, v *gocui.View) error {
+	return h.exitView(g, "bookmark")
+}
+
+func (h *handler) showBookmarks(g *gocui.Gui, v *gocui.View) error {
+	bookmarks := h.project.Bookmarks()
+	if len(bookmarks) == 0 {
+		h.popupEvents <- "No bookmarks"
+		return nil
+	}
+
+	entries := make([]listEntry, len(bookmarks))
+	for i, b := range bookmarks {
+		entries[i] = listEntry{
+			addr: b.Address,
+			text: fmt.Sprintf("%s  %s", b.Name, h.project.AddrLabel(b.Address)),
+		}
+	}
+	return h.showList(&listPopup{
+		title:    "Bookmarks",
+		entries:  entries,
+		onSelect: func(e listEntry) { h.jumpTo(e.addr) },
+		actions: map[rune]func(e listEntry){
+			'd': func(e listEntry) {
+				h.project.DeleteBookmark(bookmarks[h.list.currentIndex()].Name)
+				h.exitList(g, v)
+				h.showBookmarks(g, v)
+			},
+		},
+		help: "d: delete",
+	})
+}
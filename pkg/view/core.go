@@ -0,0 +1,58 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+	"github.com/tunz/binch-go/pkg/io"
+)
+
+// showThreads lists the threads of a core file. The faulting thread comes
+// first, and selecting a thread lists its registers.
+func (h *handler) showThreads(g *gocui.Gui, v *gocui.View) error {
+	core := h.project.CoreInfo()
+	if core == nil || len(core.Threads) == 0 {
+		h.popupEvents <- "Not a core file"
+		return nil
+	}
+	entries := make([]listEntry, len(core.Threads))
+	for i, thread := range core.Threads {
+		text := fmt.Sprintf("thread %-8d %s", thread.Pid, h.project.AddrLabel(thread.PC))
+		if thread.Signal != 0 {
+			text += " (" + binch.SignalName(thread.Signal) + ")"
+		}
+		entries[i] = listEntry{addr: thread.PC, text: text, highlight: thread.Signal != 0}
+	}
+	return h.showList(&listPopup{
+		title:   "Threads",
+		entries: entries,
+		onSelect: func(e listEntry) {
+			h.showRegisters(core.Threads[h.list.currentIndex()])
+		},
+	})
+}
+
+// showRegisters lists the registers of a thread. Selecting a register that
+// points into loaded memory goes there.
+func (h *handler) showRegisters(thread bcio.Thread) error {
+	entries := make([]listEntry, len(thread.Regs))
+	for i, reg := range thread.Regs {
+		entries[i] = listEntry{
+			addr:      reg.Value,
+			text:      fmt.Sprintf("%-9s %s", reg.Name, h.project.AddrLabel(reg.Value)),
+			highlight: reg.Value == thread.PC,
+		}
+	}
+	return h.showList(&listPopup{
+		title:   fmt.Sprintf("Registers of thread %d", thread.Pid),
+		entries: entries,
+		values:  true,
+		onSelect: func(e listEntry) {
+			if len(h.project.ReadMemory(e.addr, 1)) == 0 {
+				h.popupEvents <- "Not an address"
+				return
+			}
+			h.jumpTo(e.addr)
+		},
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/jroimartin/gocui"
 	"github.com/tunz/binch-go/pkg/core"
 	"log"
-	"strconv"
 	"strings"
 )
 
@@ -13,6 +12,29 @@ import (
 /* Draw *
 /********/
 
+const maxRawBytes = 15
+
+func lineText(instr *binch.Instruction) string {
+	text := instr.Str
+	if instr.Target != "" {
+		text += " " + instr.Target
+	}
+	if instr.Comment != "" {
+		text += " ; " + instr.Comment
+	}
+	if instr.Note != "" {
+		text += " ; " + instr.Note
+	}
+	return text
+}
+
+func lineKindOf(instr *binch.Instruction) lineKind {
+	if instr.Type != binch.CodeType {
+		return rawKind
+	}
+	return instrKind
+}
+
 func (h *handler) updateBuffer() {
 	v, _ := h.gui.View("disasm")
 	v.Clear()
@@ -24,7 +46,18 @@ func (h *handler) updateBuffer() {
 		switch line.kind {
 		case instrKind:
 			instr := line.data.(*binch.Instruction)
-			fmt.Fprintf(v, "0x%-16x% -45x%-75s", instr.Address, instr.Bytes, instr.Str)
+			fmt.Fprintf(v, "0x%-16x% -45x%-75s", h.project.ToDisplay(instr.Address), instr.Bytes, lineText(instr))
+		case rawKind:
+			data := line.data.(*binch.Instruction)
+			bytes := data.Bytes
+			if len(bytes) > maxRawBytes {
+				bytes = bytes[:maxRawBytes]
+			}
+			if idx == h.cursor {
+				fmt.Fprintf(v, "0x%-16x% -45x%-75s", h.project.ToDisplay(data.Address), bytes, lineText(data))
+			} else {
+				fmt.Fprintf(v, "0x%-16x\x1b[0;36m% -45x%-75s\x1b[m", h.project.ToDisplay(data.Address), bytes, lineText(data))
+			}
 		case symbolKind:
 			name := line.data.(string)
 			fmt.Fprintf(v, "; %s", name)
@@ -36,11 +69,15 @@ func (h *handler) updateBuffer() {
 		}
 		fmt.Fprintf(v, "\n")
 	}
+	h.reportReadError()
 }
 
 func (h *handler) redraw() {
 	origCursor := h.cursor
 	idx := h.findNextLine(0)
+	if idx == -1 {
+		return
+	}
 	firstInstr := h.lines[idx].data.(*binch.Instruction)
 	h.drawFromTop(firstInstr.Address)
 	h.cursor = origCursor
@@ -50,8 +87,9 @@ func (h *handler) redraw() {
 func (h *handler) drawFromTop(addr uint64) {
 	instr := h.project.GetInstruction(addr)
 	if instr == nil {
-		h.popupEvents <- fmt.Sprintf("No Such Instruction (Address: 0x%x)", addr)
+		h.popupEvents <- fmt.Sprintf("No Such Instruction (Address: 0x%x)", h.project.ToDisplay(addr))
 		log.Println("Failed to find a start instruction (drawFromTop)")
+		h.reportReadError()
 		return
 	}
 
@@ -71,7 +109,7 @@ func (h *handler) drawFromTop(addr uint64) {
 			i++
 		}
 		if i < h.maxLines {
-			h.lines[i].kind = instrKind
+			h.lines[i].kind = lineKindOf(instr)
 			h.lines[i].editable = true
 			h.lines[i].data = instr
 		}
@@ -91,8 +129,9 @@ func (h *handler) drawFromTop(addr uint64) {
 func (h *handler) drawFromBottom(addr uint64) {
 	instr := h.project.GetInstruction(addr)
 	if instr == nil {
-		h.popupEvents <- fmt.Sprintf("No Such Instruction (Address: 0x%x)", addr)
+		h.popupEvents <- fmt.Sprintf("No Such Instruction (Address: 0x%x)", h.project.ToDisplay(addr))
 		log.Println("Failed to find a start instruction (drawFromBottom)")
+		h.reportReadError()
 		return
 	}
 
@@ -106,7 +145,7 @@ func (h *handler) drawFromBottom(addr uint64) {
 			break
 		}
 
-		h.lines[i].kind = instrKind
+		h.lines[i].kind = lineKindOf(instr)
 		h.lines[i].editable = true
 		h.lines[i].data = instr
 		if instr.Name != "" && i > 0 {
@@ -210,15 +249,91 @@ func (h *handler) pageUp(g *gocui.Gui, v *gocui.View) error {
 
 /* Move cursor using goto command */
 func (h *handler) gotoAddr(g *gocui.Gui, v *gocui.View) error {
-	exitGoto(g, v)
+	h.exitGoto(g, v)
 	line, _ := v.Line(0)
-	if addr, err := strconv.ParseUint(line, 16, 64); err == nil {
-		h.drawFromTop(addr)
+	line = strings.TrimSpace(line)
+	if addr, exists := h.project.LookupName(line); exists {
+		if h.mainView == "hex" {
+			h.hexGoto(addr)
+		} else {
+			h.jumpTo(addr)
+		}
+	} else if addr, err := h.parseAddr(line); err == nil {
+		if h.mainView == "hex" {
+			h.hexGoto(addr)
+		} else {
+			h.drawFromTop(addr)
+		}
+	} else if line != "" {
+		h.popupEvents <- fmt.Sprintf("No Such Symbol: %s", line)
 	}
 	return nil
 }
 
-func showGoto(g *gocui.Gui, v *gocui.View) error {
+// completeGoto completes a symbol name in the goto view. If several names
+// match, it completes their common prefix.
+func (h *handler) completeGoto(g *gocui.Gui, v *gocui.View) error {
+	line, _ := v.Line(0)
+	names := h.project.CompleteName(strings.TrimSpace(line))
+	if len(names) == 0 {
+		return nil
+	}
+	completed := names[0]
+	for _, name := range names[1:] {
+		completed = commonPrefix(completed, name)
+	}
+	v.Clear()
+	v.SetOrigin(0, 0)
+	fmt.Fprint(v, completed)
+	v.SetCursor(len(completed), 0)
+	if len(names) > 1 {
+		v.Title = fmt.Sprintf("Go to Address (%d matches)", len(names))
+	} else {
+		v.Title = "Go to Address"
+	}
+	return nil
+}
+
+func commonPrefix(a, b string) string {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+// toggleSymbolize turns symbolized operands and string previews on or off.
+func (h *handler) toggleSymbolize(g *gocui.Gui, v *gocui.View) error {
+	h.project.SetSymbolize(!h.project.Symbolize())
+	h.redraw()
+	return nil
+}
+
+// toggleRawNames switches between raw and demangled symbol names.
+func (h *handler) toggleRawNames(g *gocui.Gui, v *gocui.View) error {
+	h.project.SetRawNames(!h.project.RawNames())
+	h.redraw()
+	return nil
+}
+
+// jumpTo shows addr in the disassembly if it is code, or in the hex view
+// otherwise.
+func (h *handler) jumpTo(addr uint64) {
+	if !h.project.IsCode(addr) {
+		if h.mainView == "hex" {
+			h.hexGoto(addr)
+		} else {
+			h.showHexAt(addr)
+		}
+		return
+	}
+	if h.mainView == "hex" {
+		h.exitHex(h.gui, nil)
+	}
+	h.drawFromTop(addr)
+}
+
+func (h *handler) showGoto(g *gocui.Gui, v *gocui.View) error {
 	maxX, maxY := g.Size()
 	if v, err := g.SetView("goto", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2); err != nil {
 		if err != gocui.ErrUnknownView {
@@ -235,6 +350,6 @@ func showGoto(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
-func exitGoto(g *gocui.Gui, v *gocui.View) error {
-	return exitView(g, "goto")
+func (h *handler) exitGoto(g *gocui.Gui, v *gocui.View) error {
+	return h.exitView(g, "goto")
 }
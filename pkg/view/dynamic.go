@@ -0,0 +1,147 @@
+package bcview
+
+import (
+	"debug/elf"
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"strings"
+)
+
+// dynEditKind is what the "dynEdit" input changes.
+type dynEditKind int
+
+const (
+	editInterpreter dynEditKind = iota
+	editRPath
+	editRunPath
+	addNeeded
+)
+
+var dynEditTitles = [...]string{
+	"Set interpreter",
+	"Set RPATH (empty: remove)",
+	"Set RUNPATH (empty: remove)",
+	"Add needed library",
+}
+
+// showDynamic lists the program interpreter and the dynamic section.
+func (h *handler) showDynamic(g *gocui.Gui, v *gocui.View) error {
+	entries := make([]listEntry, 0)
+	interp, err := h.project.Interpreter()
+	// The interpreter may be empty, so the row is told by the error.
+	hasInterp := err == nil
+	if hasInterp {
+		entries = append(entries, listEntry{text: fmt.Sprintf("%-14s %s", "INTERP", interp), highlight: true})
+	}
+	dyn, err := h.project.DynamicEntries()
+	if err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	searchPaths := map[elf.DynTag]string{}
+	for _, e := range dyn {
+		text := e.Tag.String()
+		if e.Str != "" {
+			text = fmt.Sprintf("%-14s %s", e.Tag, e.Str)
+		}
+		if e.Tag == elf.DT_RPATH || e.Tag == elf.DT_RUNPATH {
+			searchPaths[e.Tag] = e.Str
+		}
+		entries = append(entries, listEntry{
+			addr:      e.Value,
+			text:      text,
+			highlight: e.Str != "",
+		})
+	}
+	// dynAt returns the dynamic entry of the selected line.
+	dynAt := func() (int, bool) {
+		idx := h.list.currentIndex()
+		if hasInterp {
+			idx--
+		}
+		return idx, idx >= 0 && idx < len(dyn)
+	}
+
+	edit := func(kind dynEditKind, text string) {
+		h.exitList(g, v)
+		h.dynEdit = kind
+		h.showInput(g, "dynEdit", dynEditTitles[kind], text)
+	}
+	return h.showList(&listPopup{
+		title:   "Dynamic Section",
+		entries: entries,
+		values:  true,
+		onSelect: func(e listEntry) {
+			idx, ok := dynAt()
+			if !ok || dyn[idx].Str != "" || len(h.project.ReadMemory(dyn[idx].Value, 1)) == 0 {
+				h.popupEvents <- "Not an address"
+				return
+			}
+			h.jumpTo(dyn[idx].Value)
+		},
+		actions: map[rune]func(e listEntry){
+			'a': func(e listEntry) { edit(addNeeded, "") },
+			'd': func(e listEntry) {
+				idx, ok := dynAt()
+				if !ok || dyn[idx].Tag != elf.DT_NEEDED {
+					h.popupEvents <- "Select a NEEDED entry"
+					return
+				}
+				err := h.project.RemoveNeeded(dyn[idx].Str)
+				h.exitList(g, v)
+				if err != nil {
+					h.popupEvents <- err.Error()
+				}
+				h.showDynamic(g, v)
+			},
+			'e': func(e listEntry) {
+				idx, ok := dynAt()
+				switch {
+				case !ok && hasInterp:
+					edit(editInterpreter, interp)
+				case ok && dyn[idx].Tag == elf.DT_RPATH:
+					edit(editRPath, dyn[idx].Str)
+				case ok && dyn[idx].Tag == elf.DT_RUNPATH:
+					edit(editRunPath, dyn[idx].Str)
+				default:
+					h.popupEvents <- "Only INTERP, RPATH and RUNPATH can be edited"
+				}
+			},
+			'r': func(e listEntry) { edit(editRunPath, searchPaths[elf.DT_RUNPATH]) },
+		},
+		help: "a: add needed, d: remove needed, e: edit, r: set runpath",
+	})
+}
+
+func (h *handler) applyDynEdit(g *gocui.Gui, v *gocui.View) error {
+	text, _ := v.Line(0)
+	text = strings.TrimSpace(text)
+	var err error
+	switch h.dynEdit {
+	case editInterpreter:
+		err = h.project.SetInterpreter(text)
+	case editRPath:
+		err = h.project.SetSearchPath(elf.DT_RPATH, text)
+	case editRunPath:
+		err = h.project.SetSearchPath(elf.DT_RUNPATH, text)
+	case addNeeded:
+		if text == "" {
+			return h.exitDynEdit(g, v)
+		}
+		err = h.project.AddNeeded(text)
+	}
+	if err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	h.popupEvents <- "Dynamic section is changed. Save to write it."
+	return h.exitDynEdit(g, v)
+}
+
+func (h *handler) exitDynEdit(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	if err := h.exitView(g, "dynEdit"); err != nil {
+		return err
+	}
+	return h.showDynamic(g, v)
+}
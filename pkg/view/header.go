@@ -0,0 +1,137 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/io"
+	"strconv"
+	"strings"
+)
+
+type headerRef struct {
+	kind bcio.HeaderKind
+	idx  int
+}
+
+func (h *handler) headerTitle(ref headerRef) string {
+	switch ref.kind {
+	case bcio.ProgramHeader:
+		return fmt.Sprintf("Program Header %d", ref.idx)
+	case bcio.SectionHeader:
+		return fmt.Sprintf("Section Header %d", ref.idx)
+	}
+	return "ELF Header"
+}
+
+// showHeaders lists the ELF header, the program headers and the section
+// headers. Selecting one opens its fields.
+func (h *handler) showHeaders(g *gocui.Gui, v *gocui.View) error {
+	refs := []headerRef{{kind: bcio.FileHeader}}
+	entries := []listEntry{{addr: 0, text: "ELF header"}}
+	for idx, prog := range h.project.ProgHeaders() {
+		refs = append(refs, headerRef{kind: bcio.ProgramHeader, idx: idx})
+		entries = append(entries, listEntry{
+			addr: prog.Vaddr,
+			text: fmt.Sprintf("phdr %-3d %-14s %s", idx, prog.Type, prog.Perm),
+		})
+	}
+	for _, section := range h.project.Sections() {
+		refs = append(refs, headerRef{kind: bcio.SectionHeader, idx: section.Index})
+		entries = append(entries, listEntry{
+			addr: section.Addr,
+			text: fmt.Sprintf("shdr %-3d %-20s %-10s %s", section.Index, section.Name, section.Type, section.Perm),
+		})
+	}
+	return h.showList(&listPopup{
+		title:   "ELF Headers",
+		entries: entries,
+		onSelect: func(e listEntry) {
+			h.showHeaderFields(refs[h.list.currentIndex()])
+		},
+	})
+}
+
+// showHeaderFields lists the fields of a header with their values.
+func (h *handler) showHeaderFields(ref headerRef) error {
+	fields, err := h.project.HeaderFields(ref.kind, ref.idx)
+	if err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	entries := make([]listEntry, len(fields))
+	for i, f := range fields {
+		text := fmt.Sprintf("%-13s %s", f.Name, f.Desc)
+		if f.ReadOnly {
+			text += " (read-only)"
+		}
+		entries[i] = listEntry{addr: f.Value, text: text}
+	}
+	return h.showList(&listPopup{
+		title:   h.headerTitle(ref),
+		entries: entries,
+		values:  true,
+		onSelect: func(e listEntry) {
+			f := fields[h.list.currentIndex()]
+			if f.ReadOnly {
+				h.popupEvents <- fmt.Sprintf("%s cannot be changed", f.Name)
+				h.showHeaderFields(ref)
+				return
+			}
+			h.headerEdit = ref
+			h.headerField = f
+			title := fmt.Sprintf("Set %s", f.Name)
+			if f.Name == "p_flags" {
+				title += " (number or rwx)"
+			}
+			h.showInput(h.gui, "headerEdit", title, fmt.Sprintf("0x%x", f.Value))
+		},
+		help: "enter: edit",
+	})
+}
+
+// parseFieldValue parses a number, or permissions like "r-x" for p_flags.
+func parseFieldValue(f bcio.HeaderField, text string) (uint64, error) {
+	text = strings.TrimSpace(text)
+	if f.Name == "p_flags" && len(text) == 3 && strings.Trim(text, "rwx-") == "" {
+		value := f.Value &^ 7
+		for i, bit := range []uint64{4, 2, 1} {
+			switch text[i] {
+			case "rwx"[i]:
+				value |= bit
+			case '-':
+			default:
+				return 0, fmt.Errorf("%c must be %c or - in %q", text[i], "rwx"[i], text)
+			}
+		}
+		return value, nil
+	}
+	return strconv.ParseUint(text, 0, 64)
+}
+
+func (h *handler) applyHeaderEdit(g *gocui.Gui, v *gocui.View) error {
+	text, _ := v.Line(0)
+	value, err := parseFieldValue(h.headerField, text)
+	if err != nil {
+		h.popupEvents <- fmt.Sprintf("Invalid value: %s", text)
+		return nil
+	}
+	ref := h.headerEdit
+	if err := h.project.SetHeaderField(ref.kind, ref.idx, h.headerField.Name, value); err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	h.popupEvents <- fmt.Sprintf("%s is changed to 0x%x", h.headerField.Name, value)
+	h.exitHeaderEdit(g, v)
+	if h.mainView == "disasm" {
+		h.redraw()
+	}
+	return nil
+}
+
+func (h *handler) exitHeaderEdit(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	if err := h.exitView(g, "headerEdit"); err != nil {
+		return err
+	}
+	return h.showHeaderFields(h.headerEdit)
+}
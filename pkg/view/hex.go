@@ -0,0 +1,303 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+	"strconv"
+	"strings"
+)
+
+const hexRowSize = 16
+
+func rowOf(addr uint64) uint64 {
+	return addr &^ (hexRowSize - 1)
+}
+
+func (h *handler) hexIsMapped(addr uint64) bool {
+	for _, r := range h.hexRanges {
+		if addr >= r.Start && addr < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// hexClamp returns the nearest mapped address at or after addr, or the last
+// mapped address if there is nothing after addr.
+func (h *handler) hexClamp(addr uint64) uint64 {
+	for _, r := range h.hexRanges {
+		if addr < r.End {
+			if addr < r.Start {
+				return r.Start
+			}
+			return addr
+		}
+	}
+	return h.hexRanges[len(h.hexRanges)-1].End - 1
+}
+
+func (h *handler) hexNextRow(row uint64) (uint64, bool) {
+	for _, r := range h.hexRanges {
+		if rowOf(r.End-1) > row {
+			if next := row + hexRowSize; next >= rowOf(r.Start) {
+				return next, true
+			}
+			return rowOf(r.Start), true
+		}
+	}
+	return row, false
+}
+
+func (h *handler) hexPrevRow(row uint64) (uint64, bool) {
+	for i := len(h.hexRanges) - 1; i >= 0; i-- {
+		r := h.hexRanges[i]
+		if rowOf(r.Start) < row {
+			if prev := row - hexRowSize; prev <= rowOf(r.End-1) {
+				return prev, true
+			}
+			return rowOf(r.End - 1), true
+		}
+	}
+	return row, false
+}
+
+func hexPrintable(b byte) byte {
+	if b >= 0x20 && b < 0x7f {
+		return b
+	}
+	return '.'
+}
+
+func (h *handler) updateHexBuffer() {
+	v, _ := h.gui.View("hex")
+	v.Clear()
+
+	// The focused column is highlighted in white, and the other in cyan.
+	hexColor, asciiColor := "\x1b[0;30;47m", "\x1b[0;30;46m"
+	if h.hexASCII {
+		hexColor, asciiColor = asciiColor, hexColor
+	}
+	row := h.hexTop
+	for i := 0; i < h.maxLines; i++ {
+		data := h.project.ReadMemory(row, hexRowSize)
+		var hexPart, asciiPart strings.Builder
+		for j := uint64(0); j < hexRowSize; j++ {
+			addr := row + j
+			if j == hexRowSize/2 {
+				hexPart.WriteString(" ")
+			}
+			if !h.hexIsMapped(addr) || int(j) >= len(data) {
+				hexPart.WriteString("   ")
+				asciiPart.WriteString(" ")
+				continue
+			}
+			if addr == h.hexCursor {
+				b := data[j]
+				if h.hexNibble == 1 {
+					b = h.hexPending<<4 | b&0xf
+				}
+				fmt.Fprintf(&hexPart, "%s%02x\x1b[m ", hexColor, b)
+				fmt.Fprintf(&asciiPart, "%s%c\x1b[m", asciiColor, hexPrintable(b))
+			} else {
+				fmt.Fprintf(&hexPart, "%02x ", data[j])
+				asciiPart.WriteByte(hexPrintable(data[j]))
+			}
+		}
+		fmt.Fprintf(v, "0x%-16x%s |%s|\n", h.project.ToDisplay(row), hexPart.String(), asciiPart.String())
+
+		next, ok := h.hexNextRow(row)
+		if !ok {
+			break
+		}
+		row = next
+	}
+	h.reportReadError()
+}
+
+// hexScroll moves the top row so that the cursor is visible.
+func (h *handler) hexScroll() {
+	cursorRow := rowOf(h.hexCursor)
+	if cursorRow < h.hexTop {
+		h.hexTop = cursorRow
+		return
+	}
+	row := h.hexTop
+	for i := 1; i < h.maxLines; i++ {
+		if row == cursorRow {
+			return
+		}
+		row, _ = h.hexNextRow(row)
+	}
+	if row == cursorRow {
+		return
+	}
+	top := cursorRow
+	for i := 1; i < h.maxLines; i++ {
+		top, _ = h.hexPrevRow(top)
+	}
+	h.hexTop = top
+}
+
+func (h *handler) hexMoveTo(addr uint64) {
+	h.hexCursor = h.hexClamp(addr)
+	h.hexNibble = 0
+	h.hexScroll()
+	h.updateHexBuffer()
+}
+
+func (h *handler) hexMoveRows(n int) {
+	row := rowOf(h.hexCursor)
+	col := h.hexCursor - row
+	for ; n > 0; n-- {
+		row, _ = h.hexNextRow(row)
+	}
+	for ; n < 0; n++ {
+		row, _ = h.hexPrevRow(row)
+	}
+	h.hexMoveTo(row + col)
+}
+
+func (h *handler) hexMoveLeft() {
+	for i := len(h.hexRanges) - 1; i >= 0; i-- {
+		r := h.hexRanges[i]
+		if r.Start < h.hexCursor {
+			if h.hexCursor <= r.End {
+				h.hexMoveTo(h.hexCursor - 1)
+			} else {
+				h.hexMoveTo(r.End - 1)
+			}
+			return
+		}
+	}
+}
+
+func (h *handler) hexWrite(b byte) {
+	h.warnRelocations(h.project.WriteMemory(h.hexCursor, []byte{b}))
+	if h.hexIsMapped(h.hexCursor + 1) {
+		h.hexMoveTo(h.hexCursor + 1)
+	} else {
+		h.hexMoveTo(h.hexClamp(h.hexCursor + 1))
+	}
+}
+
+func hexDigit(ch rune) byte {
+	digit, _ := strconv.ParseUint(string(ch), 16, 8)
+	return byte(digit)
+}
+
+func (h *handler) hexEditor(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	switch {
+	case key == gocui.KeyArrowUp || (!h.hexASCII && ch == 'k'):
+		h.hexMoveRows(-1)
+	case key == gocui.KeyArrowDown || (!h.hexASCII && ch == 'j'):
+		h.hexMoveRows(1)
+	case key == gocui.KeyArrowLeft || (!h.hexASCII && ch == 'h'):
+		h.hexMoveLeft()
+	case key == gocui.KeyArrowRight || (!h.hexASCII && ch == 'l'):
+		h.hexMoveTo(h.hexCursor + 1)
+	case !h.hexASCII && ch == 'g':
+		h.showGoto(h.gui, v)
+	case !h.hexASCII && ch == 'q':
+		h.exitHex(h.gui, v)
+	case !h.hexASCII && ch == 'R':
+		h.showRelocations(h.gui, v)
+	case !h.hexASCII && isHexadecimal(ch):
+		// The high nibble is kept pending, so a byte is written at once and
+		// undone at once.
+		if h.hexNibble == 0 {
+			h.hexPending = hexDigit(ch)
+			h.hexNibble = 1
+			h.updateHexBuffer()
+		} else {
+			h.hexWrite(h.hexPending<<4 | hexDigit(ch))
+		}
+	case h.hexASCII && ch >= 0x20 && ch < 0x7f:
+		h.hexWrite(byte(ch))
+	case h.hexASCII && key == gocui.KeySpace:
+		h.hexWrite(' ')
+	}
+}
+
+func (h *handler) hexToggleColumn(g *gocui.Gui, v *gocui.View) error {
+	h.hexASCII = !h.hexASCII
+	h.hexNibble = 0
+	h.updateHexBuffer()
+	return nil
+}
+
+func (h *handler) hexPageDown(g *gocui.Gui, v *gocui.View) error {
+	h.hexMoveRows(h.maxLines - 1)
+	return nil
+}
+
+func (h *handler) hexPageUp(g *gocui.Gui, v *gocui.View) error {
+	h.hexMoveRows(-(h.maxLines - 1))
+	return nil
+}
+
+func (h *handler) hexUndo(g *gocui.Gui, v *gocui.View) error {
+	h.project.Undo()
+	h.hexNibble = 0
+	h.updateHexBuffer()
+	return nil
+}
+
+func (h *handler) showHex(g *gocui.Gui, v *gocui.View) error {
+	curInstr := h.lines[h.cursor].data.(*binch.Instruction)
+	return h.showHexAt(curInstr.Address)
+}
+
+// showHexAt opens the hex view with the cursor at addr.
+func (h *handler) showHexAt(addr uint64) error {
+	g := h.gui
+	h.hexRanges = h.project.MemoryRanges()
+	if len(h.hexRanges) == 0 {
+		h.popupEvents <- "No loaded segments"
+		return nil
+	}
+
+	x0, y0, x1, y1, err := g.ViewPosition("disasm")
+	if err != nil {
+		return err
+	}
+	hexView, err := g.SetView("hex", x0, y0, x1, y1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	hexView.Title = h.filename + " (hex)"
+	hexView.Editable = true
+	hexView.Editor = gocui.EditorFunc(h.hexEditor)
+
+	h.hexCursor = h.hexClamp(addr)
+	h.hexTop = rowOf(h.hexCursor)
+	h.hexNibble = 0
+	h.hexASCII = false
+	h.mainView = "hex"
+
+	if _, err := setCurrentViewOnTop(g, "hex"); err != nil {
+		return err
+	}
+	h.hexMoveTo(h.hexCursor)
+	return nil
+}
+
+func (h *handler) hexGoto(addr uint64) {
+	if !h.hexIsMapped(addr) {
+		h.popupEvents <- fmt.Sprintf("Unmapped Address: 0x%x", h.project.ToDisplay(addr))
+	}
+	h.hexMoveTo(addr)
+}
+
+func (h *handler) exitHex(g *gocui.Gui, v *gocui.View) error {
+	if h.findNextLine(0) == -1 {
+		h.popupEvents <- "No code to show"
+		return nil
+	}
+	h.mainView = "disasm"
+	if err := h.exitView(g, "hex"); err != nil {
+		return err
+	}
+	h.redraw()
+	return nil
+}
@@ -0,0 +1,92 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+	"strings"
+)
+
+// hookTarget is the import that the "hook" input redirects.
+type hookTarget struct {
+	name string
+	mode binch.HookMode
+}
+
+// showImports lists the imported symbols with their GOT slots, PLT stubs and
+// relocation types.
+func (h *handler) showImports(g *gocui.Gui, v *gocui.View) error {
+	imports := h.project.Imports()
+	if len(imports) == 0 {
+		h.popupEvents <- "No imports"
+		return nil
+	}
+	// The cursor is the usual place of a hook, e.g. in a code cave.
+	instr := h.lines[h.cursor].data.(*binch.Instruction)
+
+	entries := make([]listEntry, len(imports))
+	for i, imp := range imports {
+		plt := "-"
+		if imp.Plt != 0 {
+			plt = fmt.Sprintf("0x%x", h.project.ToDisplay(imp.Plt))
+		}
+		entries[i] = listEntry{
+			addr: imp.Slot,
+			text: fmt.Sprintf("%-28s plt %-10s %s", h.project.DisplayName(imp.Name), plt,
+				h.project.RelocName(imp.RelocType)),
+		}
+	}
+	hook := func(mode binch.HookMode) func(e listEntry) {
+		return func(e listEntry) {
+			h.hook = hookTarget{name: imports[h.list.currentIndex()].Name, mode: mode}
+			h.exitList(g, v)
+			title := fmt.Sprintf("Hook %s via %s (address or symbol)", h.hook.name,
+				map[binch.HookMode]string{binch.HookPLT: "PLT", binch.HookGOT: "GOT"}[mode])
+			h.showInput(g, "hook", title, fmt.Sprintf("0x%x", h.project.ToDisplay(instr.Address)))
+		}
+	}
+	return h.showList(&listPopup{
+		title:   "Imports",
+		entries: entries,
+		onSelect: func(e listEntry) {
+			imp := imports[h.list.currentIndex()]
+			if imp.Plt != 0 {
+				h.jumpTo(imp.Plt)
+			} else {
+				h.jumpTo(imp.Slot)
+			}
+		},
+		actions: map[rune]func(e listEntry){
+			'p': hook(binch.HookPLT),
+			'G': hook(binch.HookGOT),
+		},
+		help: "p: hook the PLT stub, G: hook the GOT slot",
+	})
+}
+
+func (h *handler) applyHook(g *gocui.Gui, v *gocui.View) error {
+	line, _ := v.Line(0)
+	line = strings.TrimSpace(line)
+	target, exists := h.project.LookupName(line)
+	if !exists {
+		addr, err := h.parseAddr(line)
+		if err != nil {
+			h.popupEvents <- fmt.Sprintf("No Such Symbol: %s", line)
+			return nil
+		}
+		target = addr
+	}
+	if err := h.project.HookImport(h.hook.name, target, h.hook.mode); err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	h.popupEvents <- fmt.Sprintf("%s is hooked to 0x%x", h.hook.name, h.project.ToDisplay(target))
+	h.exitHook(g, v)
+	h.redraw()
+	return nil
+}
+
+func (h *handler) exitHook(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	return h.exitView(g, "hook")
+}
@@ -0,0 +1,56 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+)
+
+// showLayout lists the section and program headers. Sections that are
+// disassembled as code are highlighted.
+func (h *handler) showLayout(g *gocui.Gui, v *gocui.View) error {
+	sections := h.project.Sections()
+	progs := h.project.ProgHeaders()
+	entries := make([]listEntry, 0, len(sections)+len(progs))
+	for _, s := range sections {
+		entries = append(entries, listEntry{
+			addr: s.Addr,
+			text: fmt.Sprintf("section %-18s %-10s off 0x%-7x size 0x%-7x %s",
+				s.Name, s.Type, s.Offset, s.Size, s.Perm),
+			highlight: s.Code,
+			unmapped:  !s.Loaded,
+		})
+	}
+	for _, prog := range progs {
+		entries = append(entries, listEntry{
+			addr: prog.Vaddr,
+			text: fmt.Sprintf("segment %-29s off 0x%-7x size 0x%-7x %s memsz 0x%x",
+				prog.Type, prog.Offset, prog.Filesz, prog.Perm, prog.Memsz),
+			unmapped: !prog.Loaded,
+		})
+	}
+	if core := h.project.CoreInfo(); core != nil {
+		for _, f := range core.Files {
+			text := fmt.Sprintf("file    %-29s off 0x%-7x size 0x%-7x", f.Path, f.Offset, f.End-f.Start)
+			if !f.Loaded {
+				text += " (not found)"
+			}
+			entries = append(entries, listEntry{addr: f.Start, text: text, highlight: f.Loaded})
+		}
+	}
+	if len(entries) == 0 {
+		h.popupEvents <- "No sections"
+		return nil
+	}
+
+	return h.showList(&listPopup{
+		title:   "Sections and Segments",
+		entries: entries,
+		onSelect: func(e listEntry) {
+			if e.unmapped {
+				h.popupEvents <- "Not loaded"
+				return
+			}
+			h.jumpTo(e.addr)
+		},
+	})
+}
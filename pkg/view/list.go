@@ -0,0 +1,221 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"strings"
+)
+
+type listEntry struct {
+	addr uint64
+	text string
+	// highlight shows the entry in green.
+	highlight bool
+	// unmapped means that addr is not in memory, so it cannot be shown.
+	unmapped bool
+}
+
+// listPopup is a filterable list of addresses. Selecting an entry calls
+// onSelect, and other keys can be bound to actions on the current entry.
+type listPopup struct {
+	title    string
+	entries  []listEntry
+	shown    []int
+	cursor   int
+	top      int
+	filter   string
+	onSelect func(e listEntry)
+	actions  map[rune]func(e listEntry)
+	help     string
+	// side places the list as a panel on the left side instead of a popup.
+	side bool
+	// values shows the numbers of entries as they are, e.g. header fields,
+	// instead of as addresses relative to the display base.
+	values bool
+}
+
+func (l *listPopup) applyFilter() {
+	l.shown = l.shown[:0]
+	filter := strings.ToLower(l.filter)
+	for idx, e := range l.entries {
+		if filter == "" || strings.Contains(strings.ToLower(e.text), filter) {
+			l.shown = append(l.shown, idx)
+		}
+	}
+	l.cursor = 0
+	l.top = 0
+}
+
+func (l *listPopup) current() (listEntry, bool) {
+	if l.cursor < 0 || l.cursor >= len(l.shown) {
+		return listEntry{}, false
+	}
+	return l.entries[l.shown[l.cursor]], true
+}
+
+// currentIndex returns the index of the current entry in entries, or -1.
+func (l *listPopup) currentIndex() int {
+	if l.cursor < 0 || l.cursor >= len(l.shown) {
+		return -1
+	}
+	return l.shown[l.cursor]
+}
+
+func (h *handler) updateList() {
+	v, err := h.gui.View("list")
+	if err != nil {
+		return
+	}
+	l := h.list
+	_, height := v.Size()
+	if l.cursor < l.top {
+		l.top = l.cursor
+	} else if l.cursor >= l.top+height {
+		l.top = l.cursor - height + 1
+	}
+
+	v.Clear()
+	v.Title = fmt.Sprintf("%s (%d/%d)", l.title, len(l.shown), len(l.entries))
+	for i := l.top; i < len(l.shown) && i < l.top+height; i++ {
+		e := l.entries[l.shown[i]]
+		addr := e.addr
+		if !l.values {
+			addr = h.project.ToDisplay(addr)
+		}
+		if i == l.cursor {
+			fmt.Fprintf(v, "\x1b[0;30;47m0x%-16x %s\x1b[m\n", addr, e.text)
+		} else if e.highlight {
+			fmt.Fprintf(v, "\x1b[0;32m0x%-16x %s\x1b[m\n", addr, e.text)
+		} else {
+			fmt.Fprintf(v, "0x%-16x %s\n", addr, e.text)
+		}
+	}
+}
+
+func (h *handler) listMove(n int) {
+	l := h.list
+	l.cursor += n
+	if l.cursor >= len(l.shown) {
+		l.cursor = len(l.shown) - 1
+	}
+	if l.cursor < 0 {
+		l.cursor = 0
+	}
+	h.updateList()
+}
+
+func (h *handler) listEditor(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	_, height := v.Size()
+	switch {
+	case key == gocui.KeyArrowUp || ch == 'k':
+		h.listMove(-1)
+	case key == gocui.KeyArrowDown || ch == 'j':
+		h.listMove(1)
+	case key == gocui.KeyCtrlB:
+		h.listMove(-height)
+	case key == gocui.KeyCtrlF:
+		h.listMove(height)
+	case ch == '/':
+		h.showListFilter(h.gui)
+	case ch == 'q':
+		h.exitList(h.gui, v)
+	default:
+		if action, exists := h.list.actions[ch]; exists {
+			if e, ok := h.list.current(); ok {
+				action(e)
+			}
+		}
+	}
+}
+
+func (h *handler) selectListEntry(g *gocui.Gui, v *gocui.View) error {
+	e, ok := h.list.current()
+	if err := h.exitList(g, v); err != nil {
+		return err
+	}
+	if ok && h.list.onSelect != nil {
+		h.list.onSelect(e)
+	}
+	return nil
+}
+
+// showList opens a list popup. The popup keeps the focus until an entry is
+// selected or it is closed.
+func (h *handler) showList(l *listPopup) error {
+	g := h.gui
+	h.list = l
+	l.shown = make([]int, 0, len(l.entries))
+	l.applyFilter()
+
+	maxX, maxY := g.Size()
+	x0, y0, x1, y1 := maxX/2-50, maxY/2-12, maxX/2+50, maxY/2+10
+	if l.side {
+		x0, y0, x1, y1 = 0, 0, maxX/3, maxY-3
+	}
+	v, err := g.SetView("list", x0, y0, x1, y1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Editable = true
+	v.Editor = gocui.EditorFunc(h.listEditor)
+
+	help := "j/k: move | /: filter | enter: go | q: close"
+	if l.help != "" {
+		help = l.help + " | " + help
+	}
+	hv, err := g.SetView("listHelp", x0, y1, x1, y1+2)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	hv.Clear()
+	fmt.Fprintf(hv, "%s", help)
+
+	if _, err := setCurrentViewOnTop(g, "list"); err != nil {
+		return err
+	}
+	h.updateList()
+	return nil
+}
+
+func (h *handler) exitList(g *gocui.Gui, v *gocui.View) error {
+	h.exitView(g, "listHelp")
+	return h.exitView(g, "list")
+}
+
+func (h *handler) listFilterEditor(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	gocui.DefaultEditor.Edit(v, key, ch, mod)
+	line, _ := v.Line(0)
+	h.list.filter = strings.TrimSpace(line)
+	h.list.applyFilter()
+	h.updateList()
+}
+
+func (h *handler) showListFilter(g *gocui.Gui) error {
+	x0, y0, x1, _, err := g.ViewPosition("list")
+	if err != nil {
+		return err
+	}
+	v, err := g.SetView("listFilter", x0, y0, x1, y0+2)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "Filter"
+		v.Editable = true
+		v.Editor = gocui.EditorFunc(h.listFilterEditor)
+		fmt.Fprintf(v, "%s", h.list.filter)
+		v.SetCursor(len(h.list.filter), 0)
+	}
+	g.Cursor = true
+	_, err = setCurrentViewOnTop(g, "listFilter")
+	return err
+}
+
+func (h *handler) exitListFilter(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	if err := g.DeleteView("listFilter"); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView("list")
+	return err
+}
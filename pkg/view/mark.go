@@ -0,0 +1,61 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+	"strconv"
+	"strings"
+)
+
+// markRegion parses "<type> [size]" and marks the region from the cursor.
+func (h *handler) markRegion(g *gocui.Gui, v *gocui.View) error {
+	line, _ := v.Line(0)
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		h.popupEvents <- "Usage: code|db|dd|dq|string|align [size]"
+		return nil
+	}
+	typ, ok := binch.ParseDataType(fields[0])
+	if !ok {
+		h.popupEvents <- fmt.Sprintf("Unknown type: %s", fields[0])
+		return nil
+	}
+
+	instr := h.lines[h.cursor].data.(*binch.Instruction)
+	size := h.project.DefaultRegionSize(instr.Address, typ)
+	if len(fields) == 2 {
+		var err error
+		if size, err = strconv.ParseUint(fields[1], 0, 64); err != nil {
+			h.popupEvents <- fmt.Sprintf("Invalid size: %s", fields[1])
+			return nil
+		}
+	}
+
+	h.exitMark(g, v)
+	h.project.MarkRegion(instr.Address, size, typ)
+	h.redraw()
+	return nil
+}
+
+func (h *handler) showMark(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("mark", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "Mark as code|db|dd|dq|string|align [size]"
+		v.Editable = true
+		v.Clear()
+		if _, err := setCurrentViewOnTop(g, "mark"); err != nil {
+			return err
+		}
+	}
+	g.Cursor = true
+	return nil
+}
+
+func (h *handler) exitMark(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	return h.exitView(g, "mark")
+}
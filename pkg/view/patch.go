@@ -28,6 +28,25 @@ func nopPadding(bytes []byte, size int) []byte {
 }
 
 func (h *handler) patchByte(g *gocui.Gui, v *gocui.View) error {
+	instr := h.lines[h.cursor].data.(*binch.Instruction)
+	str, _ := v.Line(0)
+	bytes := hex2bytes(str)
+	if isSameBytes(bytes, instr.Bytes) {
+		return h.exitPatch(g, v)
+	}
+
+	// Byte patches are applied as typed even if they do not decode to a single
+	// instruction, so a single undo restores the original bytes.
+	relocs := h.project.WriteMemory(instr.Address, bytes)
+	if newInstr := h.project.Disassemble(bytes, instr.Address); newInstr == nil {
+		h.popupEvents <- fmt.Sprintf("Patched %d bytes, but they are not a valid instruction", len(bytes))
+	} else if len(newInstr.Bytes) != len(bytes) {
+		h.popupEvents <- fmt.Sprintf("Patched %d bytes, but the new instruction is %d bytes (%d bytes left over)",
+			len(bytes), len(newInstr.Bytes), len(bytes)-len(newInstr.Bytes))
+	}
+	h.redraw()
+	h.exitPatch(g, v)
+	h.warnRelocations(relocs)
 	return nil
 }
 
@@ -36,21 +55,28 @@ func (h *handler) patchInstr(g *gocui.Gui, v *gocui.View) error {
 	str, _ := v.Line(0)
 	if bytes := h.project.Assemble(str, instr.Address); bytes != nil {
 		padded := nopPadding(bytes, len(instr.Bytes))
-		h.project.WriteMemory(instr.Address, padded)
+		relocs := h.project.WriteMemory(instr.Address, padded)
 		h.redraw()
-		return h.exitPatch(g, v)
+		h.exitPatch(g, v)
+		h.warnRelocations(relocs)
+		return nil
 	}
 	return nil
 }
 
 func (h *handler) deleteInstr(g *gocui.Gui, v *gocui.View) error {
+	if h.lines[h.cursor].kind != instrKind {
+		h.popupEvents <- "Not an instruction"
+		return nil
+	}
 	instr := h.lines[h.cursor].data.(*binch.Instruction)
 	nop := make([]byte, len(instr.Bytes))
 	for i := 0; i < len(instr.Bytes); i++ {
 		nop[i] = 0x90
 	}
-	h.project.WriteMemory(instr.Address, nop)
+	relocs := h.project.WriteMemory(instr.Address, nop)
 	h.redraw()
+	h.warnRelocations(relocs)
 	return nil
 }
 
@@ -201,6 +227,11 @@ func (h *handler) watchByteChange(byteView, instrView *gocui.View, addr uint64)
 }
 
 func (h *handler) showPatch(g *gocui.Gui, v *gocui.View) error {
+	if h.lines[h.cursor].kind == rawKind {
+		// Data lines are edited byte by byte in the hex view.
+		return h.showHex(g, v)
+	}
+
 	var err error
 	var byteView, instrView *gocui.View
 
@@ -212,6 +243,9 @@ func (h *handler) showPatch(g *gocui.Gui, v *gocui.View) error {
 		v.Title = "Patch"
 	}
 	curInstr := h.lines[h.cursor].data.(*binch.Instruction)
+	if v, err := g.View("patch"); err == nil {
+		v.Title = "Patch" + h.relocWarning(curInstr.Address, uint64(len(curInstr.Bytes)))
+	}
 	if byteView, err = g.SetView("patchByte", maxX/2-35, maxY/2-3, maxX/2+35, maxY/2-1); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
@@ -271,9 +305,9 @@ func patchMoveFocus(g *gocui.Gui, v *gocui.View) error {
 
 func (h *handler) exitPatch(g *gocui.Gui, v *gocui.View) error {
 	g.Cursor = false
-	exitView(g, "patchByte")
-	exitView(g, "patchInstr")
-	exitView(g, "patch")
+	h.exitView(g, "patchByte")
+	h.exitView(g, "patchInstr")
+	h.exitView(g, "patch")
 	close(h.byteEvents)
 	close(h.instrEvents)
 	return nil
@@ -0,0 +1,41 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"strconv"
+	"strings"
+)
+
+// parseAddr parses an entered hex address, with or without "0x", and
+// converts it from the display base to a file address.
+func (h *handler) parseAddr(text string) (uint64, error) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(text, "0x"), 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return h.project.FromDisplay(addr), nil
+}
+
+func (h *handler) showBase(g *gocui.Gui, v *gocui.View) error {
+	return h.showInput(g, "base", "Display base, e.g. 0x555555554000 (0: file addresses)",
+		fmt.Sprintf("0x%x", h.project.DisplayBase()))
+}
+
+func (h *handler) applyBase(g *gocui.Gui, v *gocui.View) error {
+	line, _ := v.Line(0)
+	base, err := strconv.ParseUint(strings.TrimSpace(line), 0, 64)
+	if err != nil {
+		h.popupEvents <- fmt.Sprintf("Invalid base: %s", strings.TrimSpace(line))
+		return nil
+	}
+	h.project.SetDisplayBase(base)
+	h.exitBase(g, v)
+	h.redraw()
+	return nil
+}
+
+func (h *handler) exitBase(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	return h.exitView(g, "base")
+}
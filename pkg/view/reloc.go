@@ -0,0 +1,82 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+	"github.com/tunz/binch-go/pkg/io"
+)
+
+// relocWarning returns a warning for a patch preview, or "" if no relocation
+// writes into the patched bytes.
+func (h *handler) relocWarning(addr uint64, size uint64) string {
+	relocs := h.project.RelocationsAt(addr, size)
+	if len(relocs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" - overwritten at load time by %s", h.project.RelocDesc(relocs[0]))
+}
+
+// warnRelocations lists the relocations that overwrite a patch, if any.
+func (h *handler) warnRelocations(relocs []bcio.Relocation) {
+	if len(relocs) == 0 {
+		return
+	}
+	if h.mainView == "hex" {
+		// A popup for every typed byte would be in the way.
+		h.popupEvents <- fmt.Sprintf("Overwritten at load time by %s (R: show)", h.project.RelocDesc(relocs[0]))
+		return
+	}
+	h.showRelocationList("Relocations overwrite the patch", relocs)
+}
+
+// showRelocations lists the relocations of the current line, or of the byte
+// under the cursor in the hex view.
+func (h *handler) showRelocations(g *gocui.Gui, v *gocui.View) error {
+	var relocs []bcio.Relocation
+	if h.mainView == "hex" {
+		relocs = h.project.RelocationsAt(h.hexCursor, 1)
+	} else {
+		instr := h.lines[h.cursor].data.(*binch.Instruction)
+		relocs = h.project.RelocationsAt(instr.Address, uint64(len(instr.Bytes)))
+	}
+	if len(relocs) == 0 {
+		h.popupEvents <- "No relocations"
+		return nil
+	}
+	return h.showRelocationList("Relocations", relocs)
+}
+
+func (h *handler) showRelocationList(title string, relocs []bcio.Relocation) error {
+	entries := make([]listEntry, len(relocs))
+	for i, reloc := range relocs {
+		entries[i] = listEntry{addr: reloc.Addr, text: h.project.RelocDesc(reloc)}
+	}
+	apply := func(op func(bcio.Relocation) error, done string) func(e listEntry) {
+		return func(e listEntry) {
+			if err := op(relocs[h.list.currentIndex()]); err != nil {
+				h.popupEvents <- err.Error()
+				return
+			}
+			h.exitList(h.gui, nil)
+			h.popupEvents <- done
+			if h.mainView == "disasm" {
+				h.redraw()
+			}
+		}
+	}
+	return h.showList(&listPopup{
+		title:   title,
+		entries: entries,
+		onSelect: func(e listEntry) {
+			if e.addr != 0 {
+				h.jumpTo(e.addr)
+			}
+		},
+		actions: map[rune]func(e listEntry){
+			'x': apply(h.project.RemoveRelocation, "Relocation is removed"),
+			'a': apply(h.project.AdjustRelocation, "Relocation follows the patch"),
+		},
+		help: "enter: go to the entry, x: remove, a: adjust to the patch",
+	})
+}
@@ -0,0 +1,126 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+	"strconv"
+	"strings"
+)
+
+func (h *handler) returnPatchBytes(v *gocui.View) []byte {
+	str, _ := v.Line(0)
+	val, err := strconv.ParseInt(strings.TrimSpace(str), 0, 64)
+	if err != nil {
+		return nil
+	}
+	return h.project.ReturnPatch(h.retPatchAddr, val, h.retPatchPad)
+}
+
+func (h *handler) updateReturnPreview(valueView *gocui.View) {
+	previewView, err := h.gui.View("retPreview")
+	if err != nil {
+		return
+	}
+	previewView.Clear()
+	if h.retPatchPad {
+		previewView.Title = "Preview (tab: keep rest)"
+	} else {
+		previewView.Title = "Preview (tab: nop rest)"
+	}
+
+	patch := h.returnPatchBytes(valueView)
+	if patch == nil {
+		fmt.Fprintf(previewView, "\x1b[0;31mInvalid Value\x1b[m\n")
+		return
+	}
+	previewView.Title += h.relocWarning(h.retPatchAddr, uint64(len(patch)))
+	for off := 0; off < len(patch); {
+		addr := h.retPatchAddr + uint64(off)
+		instr := h.project.Disassemble(patch[off:], addr)
+		if instr == nil {
+			fmt.Fprintf(previewView, "0x%-16x\x1b[0;31m% x\x1b[m\n", h.project.ToDisplay(addr), patch[off:])
+			break
+		}
+		fmt.Fprintf(previewView, "0x%-16x\x1b[0;32m% -24x\x1b[m%s\n", h.project.ToDisplay(addr), instr.Bytes, instr.Str)
+		off += len(instr.Bytes)
+	}
+}
+
+func (h *handler) returnValueEditor(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	if key == gocui.KeyArrowDown || key == gocui.KeyArrowUp {
+		return
+	}
+	gocui.DefaultEditor.Edit(v, key, ch, mod)
+	h.updateReturnPreview(v)
+}
+
+func (h *handler) toggleReturnPad(g *gocui.Gui, v *gocui.View) error {
+	h.retPatchPad = !h.retPatchPad
+	h.updateReturnPreview(v)
+	return nil
+}
+
+func (h *handler) applyReturnPatch(g *gocui.Gui, v *gocui.View) error {
+	if patch := h.returnPatchBytes(v); patch != nil {
+		relocs := h.project.WriteMemory(h.retPatchAddr, patch)
+		h.drawFromTop(h.retPatchAddr)
+		h.popupEvents <- fmt.Sprintf("Patched to return (%d bytes)", len(patch))
+		h.exitReturnPatch(g, v)
+		h.warnRelocations(relocs)
+	}
+	return nil
+}
+
+func (h *handler) showReturnPatch(g *gocui.Gui, v *gocui.View) error {
+	curInstr := h.lines[h.cursor].data.(*binch.Instruction)
+	name, start, ok := h.project.FindFunction(curInstr.Address)
+	if !ok {
+		h.popupEvents <- fmt.Sprintf("No function contains 0x%x", h.project.ToDisplay(curInstr.Address))
+		return nil
+	}
+	h.retPatchAddr = start
+	h.retPatchPad = true
+
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("retPatch", maxX/2-40, maxY/2-6, maxX/2+40, maxY/2+6); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = fmt.Sprintf("Return Patch: %s (0x%x)", name, h.project.ToDisplay(start))
+	}
+	valueView, err := g.SetView("retValue", maxX/2-35, maxY/2-5, maxX/2+35, maxY/2-3)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		valueView.Title = "Return Value"
+		valueView.Editable = true
+		valueView.Editor = gocui.EditorFunc(h.returnValueEditor)
+		fmt.Fprintf(valueView, "0")
+		if err := valueView.SetCursor(1, 0); err != nil {
+			return err
+		}
+	}
+	if v, err := g.SetView("retPreview", maxX/2-35, maxY/2-2, maxX/2+35, maxY/2+5); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Wrap = false
+	}
+	g.Cursor = true
+
+	if _, err := setCurrentViewOnTop(g, "retValue"); err != nil {
+		return err
+	}
+	h.updateReturnPreview(valueView)
+	return nil
+}
+
+func (h *handler) exitReturnPatch(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	h.exitView(g, "retPreview")
+	h.exitView(g, "retValue")
+	h.exitView(g, "retPatch")
+	return nil
+}
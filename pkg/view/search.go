@@ -0,0 +1,92 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+)
+
+func searchTitle(mode binch.SearchMode) string {
+	return fmt.Sprintf("Search [%s] (tab: mode)", mode)
+}
+
+func (h *handler) toggleSearchMode(g *gocui.Gui, v *gocui.View) error {
+	h.searchMode = h.searchMode.Next()
+	v.Title = searchTitle(h.searchMode)
+	return nil
+}
+
+func (h *handler) runSearch(g *gocui.Gui, v *gocui.View) error {
+	query, _ := v.Line(0)
+	hits, err := h.project.Search(h.searchMode, query)
+	if err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	h.exitSearch(g, v)
+	if len(hits) == 0 {
+		h.popupEvents <- fmt.Sprintf("Not found: %s", query)
+		return nil
+	}
+
+	h.searchHits = hits
+	h.searchIdx = 0
+	entries := make([]listEntry, len(hits))
+	for i, hit := range hits {
+		entries[i] = listEntry{addr: hit.Address, text: hit.Text}
+	}
+	return h.showList(&listPopup{
+		title:   fmt.Sprintf("Search [%s] %s", h.searchMode, query),
+		entries: entries,
+		onSelect: func(e listEntry) {
+			for i, hit := range h.searchHits {
+				if hit.Address == e.addr {
+					h.searchIdx = i
+				}
+			}
+			h.jumpTo(e.addr)
+		},
+	})
+}
+
+func (h *handler) showSearch(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("search", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = searchTitle(h.searchMode)
+		v.Editable = true
+		if _, err := setCurrentViewOnTop(g, "search"); err != nil {
+			return err
+		}
+	}
+	g.Cursor = true
+	return nil
+}
+
+func (h *handler) exitSearch(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	return h.exitView(g, "search")
+}
+
+func (h *handler) moveSearchHit(step int) {
+	if len(h.searchHits) == 0 {
+		h.popupEvents <- "No search results"
+		return
+	}
+	h.searchIdx = (h.searchIdx + step + len(h.searchHits)) % len(h.searchHits)
+	hit := h.searchHits[h.searchIdx]
+	h.popupEvents <- fmt.Sprintf("Hit %d/%d: 0x%x", h.searchIdx+1, len(h.searchHits), h.project.ToDisplay(hit.Address))
+	h.jumpTo(hit.Address)
+}
+
+func (h *handler) nextSearchHit(g *gocui.Gui, v *gocui.View) error {
+	h.moveSearchHit(1)
+	return nil
+}
+
+func (h *handler) prevSearchHit(g *gocui.Gui, v *gocui.View) error {
+	h.moveSearchHit(-1)
+	return nil
+}
@@ -0,0 +1,151 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"github.com/tunz/binch-go/pkg/core"
+	"strconv"
+)
+
+func stringEntryText(s binch.FoundString, refs int) string {
+	enc := "A"
+	if s.Encoding == binch.UTF16String {
+		enc = "W"
+	}
+	return fmt.Sprintf("[%s] %-5d %s", enc, refs, strconv.Quote(s.Text))
+}
+
+// escapeString shows the text of a string on one line, e.g. with "\n" for
+// newlines, so that the editor keeps every character.
+func escapeString(text string) string {
+	quoted := strconv.Quote(text)
+	return quoted[1 : len(quoted)-1]
+}
+
+func unescapeString(text string) (string, error) {
+	unquoted, err := strconv.Unquote(`"` + text + `"`)
+	if err != nil {
+		return "", fmt.Errorf("invalid escape in %q", text)
+	}
+	return unquoted, nil
+}
+
+func (h *handler) showStrings(g *gocui.Gui, v *gocui.View) error {
+	h.strings = h.project.Strings(h.opts.MinStringLen)
+	if len(h.strings) == 0 {
+		h.popupEvents <- "No strings"
+		return nil
+	}
+
+	entries := make([]listEntry, len(h.strings))
+	for i, s := range h.strings {
+		entries[i] = listEntry{
+			addr: s.Address,
+			text: stringEntryText(s, len(h.project.References(s.Address))),
+		}
+	}
+	return h.showList(&listPopup{
+		title:    "Strings",
+		entries:  entries,
+		onSelect: func(e listEntry) { h.jumpTo(e.addr) },
+		actions: map[rune]func(e listEntry){
+			'x': h.showStringRefs,
+			'e': func(e listEntry) { h.showStringEdit(g) },
+		},
+		help: "x: references | e: edit",
+	})
+}
+
+func (h *handler) findString(addr uint64) (int, bool) {
+	for i, s := range h.strings {
+		if s.Address == addr {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (h *handler) showStringRefs(e listEntry) {
+	refs := h.project.References(e.addr)
+	if len(refs) == 0 {
+		h.popupEvents <- fmt.Sprintf("No references to 0x%x", h.project.ToDisplay(e.addr))
+		return
+	}
+
+	entries := make([]listEntry, 0, len(refs))
+	for _, ref := range refs {
+		if instr := h.project.GetInstruction(ref); instr != nil {
+			entries = append(entries, listEntry{addr: ref, text: instr.Str})
+		}
+	}
+	h.exitList(h.gui, nil)
+	h.showList(&listPopup{
+		title:    fmt.Sprintf("References to 0x%x", h.project.ToDisplay(e.addr)),
+		entries:  entries,
+		onSelect: func(e listEntry) { h.jumpTo(e.addr) },
+	})
+}
+
+func (h *handler) showStringEdit(g *gocui.Gui) error {
+	e, ok := h.list.current()
+	if !ok {
+		return nil
+	}
+	idx, ok := h.findString(e.addr)
+	if !ok {
+		return nil
+	}
+	s := h.strings[idx]
+
+	maxX, maxY := g.Size()
+	v, err := g.SetView("strEdit", maxX/2-40, maxY/2, maxX/2+40, maxY/2+2)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Editable = true
+		text := escapeString(s.Text)
+		fmt.Fprintf(v, "%s", text)
+		v.SetCursor(len(text), 0)
+	}
+	v.Title = fmt.Sprintf("Edit String at 0x%x (max %d bytes)", h.project.ToDisplay(s.Address), s.Size)
+	g.Cursor = true
+	_, err = setCurrentViewOnTop(g, "strEdit")
+	return err
+}
+
+func (h *handler) applyStringEdit(g *gocui.Gui, v *gocui.View) error {
+	e, _ := h.list.current()
+	idx, _ := h.findString(e.addr)
+	s := h.strings[idx]
+	line, _ := v.Line(0)
+	text, err := unescapeString(line)
+	if err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+	if text == s.Text {
+		return h.exitStringEdit(g, v)
+	}
+	if err := h.project.WriteString(s, text); err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
+
+	h.strings[idx].Text = text
+	h.list.entries[h.list.shown[h.list.cursor]].text = stringEntryText(h.strings[idx], len(h.project.References(s.Address)))
+	h.popupEvents <- fmt.Sprintf("String at 0x%x is patched", h.project.ToDisplay(s.Address))
+	return h.exitStringEdit(g, v)
+}
+
+func (h *handler) exitStringEdit(g *gocui.Gui, v *gocui.View) error {
+	g.Cursor = false
+	if err := g.DeleteView("strEdit"); err != nil {
+		return err
+	}
+	if _, err := g.SetCurrentView("list"); err != nil {
+		return err
+	}
+	h.updateList()
+	return nil
+}
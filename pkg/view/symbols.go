@@ -0,0 +1,32 @@
+package bcview
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+)
+
+func (h *handler) showSymbols(g *gocui.Gui, v *gocui.View) error {
+	symbols := h.project.SymbolEntries()
+	if len(symbols) == 0 {
+		h.popupEvents <- "No symbols"
+		return nil
+	}
+
+	entries := make([]listEntry, len(symbols))
+	for i, s := range symbols {
+		kind := s.Kind.String()
+		if s.Detected {
+			kind = "sub"
+		}
+		entries[i] = listEntry{
+			addr: s.Addr,
+			text: fmt.Sprintf("%-6s %8x  %s", kind, s.Size, s.Name),
+		}
+	}
+	return h.showList(&listPopup{
+		title:    "Symbols",
+		entries:  entries,
+		onSelect: func(e listEntry) { h.jumpTo(e.addr) },
+		side:     true,
+	})
+}
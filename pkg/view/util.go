@@ -14,11 +14,11 @@ func setCurrentViewOnTop(g *gocui.Gui, name string) (*gocui.View, error) {
 	return g.SetViewOnTop(name)
 }
 
-func exitView(g *gocui.Gui, name string) error {
+func (h *handler) exitView(g *gocui.Gui, name string) error {
 	if err := g.DeleteView(name); err != nil {
 		return err
 	}
-	if _, err := g.SetCurrentView("disasm"); err != nil {
+	if _, err := g.SetCurrentView(h.mainView); err != nil {
 		return err
 	}
 	return nil
@@ -39,7 +39,21 @@ func popupLoop(g *gocui.Gui, v *gocui.View, popupEvents chan string) {
 			time.Sleep(time.Second * 2)
 		}
 		v.Clear()
-		fmt.Fprintf(v, "q: quit | Enter: patch | d: delete | s: save | ctrl+z: undo")
+		fmt.Fprintf(v, "q: quit | Enter: patch | d: delete | r: return | x: hex | t: type | /: search | \": strings | s: save | ctrl+z: undo")
 		flush(g)
 	}
 }
+
+// reportReadError shows a failure to read memory, e.g. of a process that
+// exited, once until reading works again.
+func (h *handler) reportReadError() {
+	err := h.project.ReadError()
+	if err == nil {
+		h.readErr = ""
+		return
+	}
+	if err.Error() != h.readErr {
+		h.readErr = err.Error()
+		h.popupEvents <- err.Error()
+	}
+}
@@ -23,8 +23,18 @@ type lineInfo struct {
 	data     interface{}
 }
 
+// Options configures binch UI.
+type Options struct {
+	MinStringLen int
+	// ProjectFile keeps user labels and comments.
+	ProjectFile string
+	// Base is the address that addresses are shown relative to, or 0.
+	Base uint64
+}
+
 type handler struct {
 	filename    string
+	opts        Options
 	project     *binch.Project
 	maxLines    int
 	lines       []lineInfo
@@ -34,6 +44,34 @@ type handler struct {
 	byteEvents  chan string
 	popupEvents chan string
 	mux         sync.Mutex
+
+	retPatchAddr uint64
+	retPatchPad  bool
+
+	mainView   string
+	hexRanges  []binch.MemoryRange
+	hexTop     uint64
+	hexCursor  uint64
+	hexNibble  int
+	hexPending byte
+	hexASCII   bool
+
+	list       *listPopup
+	searchMode binch.SearchMode
+	searchHits []binch.SearchHit
+	searchIdx  int
+	strings    []binch.FoundString
+
+	bookmarkSet bool
+
+	headerEdit  headerRef
+	headerField bcio.HeaderField
+
+	dynEdit dynEditKind
+	hook    hookTarget
+
+	// readErr is the last reported failure to read memory.
+	readErr string
 }
 
 func (h *handler) layout(g *gocui.Gui) error {
@@ -47,29 +85,44 @@ func (h *handler) layout(g *gocui.Gui) error {
 		v.Title = h.filename
 
 		_, h.maxLines = v.Size()
+		start, hasCode := h.project.StartAddress()
 		if h.lines == nil {
 			h.lines = make([]lineInfo, h.maxLines)
-			h.drawFromTop(h.project.Entry())
+			for i := range h.lines {
+				h.lines[i].kind = emptyKind
+			}
+			if hasCode {
+				h.drawFromTop(start)
+			}
 		}
 
 		if _, err := g.SetCurrentView("disasm"); err != nil {
 			return err
 		}
+		if !hasCode {
+			// e.g. a core file whose mapped files are not found.
+			h.popupEvents <- "No code to show"
+			if err := h.showHexAt(start); err != nil {
+				return err
+			}
+		}
 	}
 	if v, err := g.SetView("helper", left, maxY-3, maxX-left, maxY-1); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
-		h.popupEvents = make(chan string, 20)
 		go popupLoop(g, v, h.popupEvents)
-		h.popupEvents <- ""
+		h.popupEvents <- h.project.CrashSummary()
 	}
 	return nil
 }
 
 func (h *handler) saveFile(g *gocui.Gui, v *gocui.View) error {
+	if err := h.project.Save(); err != nil {
+		h.popupEvents <- err.Error()
+		return nil
+	}
 	h.popupEvents <- "Saved"
-	h.project.Save()
 	return nil
 }
 
@@ -80,6 +133,18 @@ func (h *handler) undo(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+// withLines ignores a key of the disassembly when it has no lines, e.g. in a
+// core file without code or memory.
+func (h *handler) withLines(fn func(g *gocui.Gui, v *gocui.View) error) func(g *gocui.Gui, v *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if h.findNextLine(0) == -1 {
+			h.popupEvents <- "No code to show"
+			return nil
+		}
+		return fn(g, v)
+	}
+}
+
 func quit(g *gocui.Gui, v *gocui.View) error {
 	return gocui.ErrQuit
 }
@@ -100,20 +165,86 @@ func initKeybindings(g *gocui.Gui, h *handler) error {
 		gocui.KeyArrowDown: h.cursorDown,
 		gocui.KeyCtrlF:     h.pageDown,
 		gocui.KeyCtrlB:     h.pageUp,
-		'g':                showGoto,
+		'g':                h.showGoto,
 		'q':                quit,
 		gocui.KeyEnter:     h.showPatch,
 		's':                h.saveFile,
 		'd':                h.deleteInstr,
+		'r':                h.showReturnPatch,
+		'x':                h.showHex,
+		't':                h.showMark,
+		'/':                h.showSearch,
+		'n':                h.nextSearchHit,
+		'N':                h.prevSearchHit,
+		'"':                h.showStrings,
+		'f':                h.showSymbols,
+		'D':                h.toggleRawNames,
+		'o':                h.toggleSymbolize,
+		'l':                h.showRename,
+		'c':                h.showComment,
+		'm':                h.showSetBookmark,
+		'\'':               h.showJumpBookmark,
+		'M':                h.showBookmarks,
+		'S':                h.showLayout,
+		'H':                h.showHeaders,
+		'L':                h.showDynamic,
+		'i':                h.showImports,
+		'R':                h.showRelocations,
+		'B':                h.showBase,
+		'T':                h.showThreads,
 		gocui.KeyCtrlZ:     h.undo,
 	}
 
+	for key, fn := range key2fn["disasm"] {
+		if key != 'q' {
+			key2fn["disasm"][key] = h.withLines(fn)
+		}
+	}
+
 	/* Goto */
 	key2fn["goto"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
-		gocui.KeyEsc:   exitGoto,
+		gocui.KeyEsc:   h.exitGoto,
+		gocui.KeyTab:   h.completeGoto,
 		gocui.KeyEnter: h.gotoAddr,
 	}
 
+	/* Annotations */
+	key2fn["rename"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitRename,
+		gocui.KeyEnter: h.applyRename,
+	}
+
+	key2fn["comment"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitComment,
+		gocui.KeyEnter: h.applyComment,
+	}
+
+	/* Bookmark */
+	key2fn["bookmark"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc: h.exitBookmark,
+	}
+
+	/* Headers */
+	key2fn["headerEdit"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitHeaderEdit,
+		gocui.KeyEnter: h.applyHeaderEdit,
+	}
+
+	key2fn["dynEdit"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitDynEdit,
+		gocui.KeyEnter: h.applyDynEdit,
+	}
+
+	key2fn["hook"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitHook,
+		gocui.KeyEnter: h.applyHook,
+	}
+
+	key2fn["base"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitBase,
+		gocui.KeyEnter: h.applyBase,
+	}
+
 	/* Patch */
 	key2fn["patchByte"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
 		gocui.KeyEsc:       h.exitPatch,
@@ -129,6 +260,52 @@ func initKeybindings(g *gocui.Gui, h *handler) error {
 		gocui.KeyEnter:   h.patchInstr,
 	}
 
+	/* Search */
+	key2fn["search"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitSearch,
+		gocui.KeyTab:   h.toggleSearchMode,
+		gocui.KeyEnter: h.runSearch,
+	}
+
+	/* List */
+	key2fn["list"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitList,
+		gocui.KeyEnter: h.selectListEntry,
+	}
+
+	key2fn["listFilter"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitListFilter,
+		gocui.KeyEnter: h.exitListFilter,
+	}
+
+	/* Strings */
+	key2fn["strEdit"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitStringEdit,
+		gocui.KeyEnter: h.applyStringEdit,
+	}
+
+	/* Mark */
+	key2fn["mark"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitMark,
+		gocui.KeyEnter: h.markRegion,
+	}
+
+	/* Hex */
+	key2fn["hex"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitHex,
+		gocui.KeyTab:   h.hexToggleColumn,
+		gocui.KeyCtrlF: h.hexPageDown,
+		gocui.KeyCtrlB: h.hexPageUp,
+		gocui.KeyCtrlZ: h.hexUndo,
+	}
+
+	/* Return Patch */
+	key2fn["retValue"] = map[interface{}]func(g *gocui.Gui, v *gocui.View) error{
+		gocui.KeyEsc:   h.exitReturnPatch,
+		gocui.KeyTab:   h.toggleReturnPad,
+		gocui.KeyEnter: h.applyReturnPatch,
+	}
+
 	/* Help */
 
 	for view, m := range key2fn {
@@ -143,7 +320,7 @@ func initKeybindings(g *gocui.Gui, h *handler) error {
 }
 
 // Run starts up binch UI.
-func Run(filename string, b *bcio.Binary) {
+func Run(filename string, s bcio.Storage, opts Options) {
 	g, err := gocui.NewGui(gocui.OutputNormal)
 	if err != nil {
 		log.Panicln(err)
@@ -152,11 +329,23 @@ func Run(filename string, b *bcio.Binary) {
 
 	h := handler{
 		filename: filename,
-		project:  binch.MakeProject(b),
+		opts:     opts,
+		project:  binch.MakeProject(s),
 		maxLines: 0,
 		lines:    nil,
 		cursor:   0,
 		gui:      g,
+		mainView: "disasm",
+		// Messages are queued until the helper view shows them.
+		popupEvents: make(chan string, 20),
+	}
+	if opts.ProjectFile != "" {
+		if err := h.project.OpenAnnotations(opts.ProjectFile); err != nil {
+			log.Panicln(err)
+		}
+	}
+	if opts.Base != 0 {
+		h.project.SetDisplayBase(opts.Base)
 	}
 
 	g.InputEsc = true